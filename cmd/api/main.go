@@ -3,23 +3,66 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/internal/core/services/accountsrv"
+	"filesms/internal/core/services/adminsrv"
+	"filesms/internal/core/services/apitokensrv"
 	"filesms/internal/core/services/authsrv"
 	"filesms/internal/core/services/cleanupservice"
 	"filesms/internal/core/services/filesrv"
+	"filesms/internal/core/services/jobsrv"
+	"filesms/internal/core/services/lifecyclesrv"
+	"filesms/internal/core/services/oidcsrv"
+	"filesms/internal/core/services/retentionsrv"
+	"filesms/internal/core/services/schedulersrv"
+	"filesms/internal/core/services/scrubsrv"
+	"filesms/internal/core/services/sharesrv"
+	"filesms/internal/handlers/accounthdl"
+	"filesms/internal/handlers/adminhdl"
+	"filesms/internal/handlers/apitokenhdl"
 	"filesms/internal/handlers/authhdl"
 	"filesms/internal/handlers/filehdl"
+	"filesms/internal/handlers/jobhdl"
+	"filesms/internal/handlers/lifecyclehdl"
+	"filesms/internal/handlers/oidchdl"
+	"filesms/internal/handlers/retentionhdl"
+	"filesms/internal/handlers/schedulerhdl"
+	"filesms/internal/handlers/sharehdl"
+	"filesms/internal/repositories/accesslogrepo"
+	"filesms/internal/repositories/apitokenrepo"
+	"filesms/internal/repositories/blobdeletionrepo"
 	"filesms/internal/repositories/filerepo"
+	"filesms/internal/repositories/identityrepo"
+	"filesms/internal/repositories/jobrepo"
+	"filesms/internal/repositories/lifecyclerepo"
+	"filesms/internal/repositories/recoverycoderepo"
+	"filesms/internal/repositories/retentionrepo"
+	"filesms/internal/repositories/schedulerepo"
+	"filesms/internal/repositories/sessionrepo"
+	"filesms/internal/repositories/thumbnailrepo"
+	"filesms/internal/repositories/tokenrepo"
 	"filesms/internal/repositories/userrepo"
+	"filesms/internal/repositories/usertokenrepo"
+	"flag"
 
 	response "filesms/pkg/api"
 	redisStore "filesms/pkg/cache/redis"
 	"filesms/pkg/jwt"
+	"filesms/pkg/leader"
+	"filesms/pkg/mailer"
 	"filesms/pkg/middleware"
+	"filesms/pkg/oidc"
+	"filesms/pkg/presign"
+	"filesms/pkg/scanner"
 	"filesms/pkg/storage"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -27,6 +70,8 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+const minUploadSecretLength = 32
+
 func main() {
 	/*
 		// if running locally load env variables from .env file
@@ -45,6 +90,13 @@ func main() {
 	}
 	defer db.Close()
 
+	// "fsck" checks storage against the database once and exits
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		code := runFsck(db, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
 	// Run migrations
 	/*
 		err = database.RunMigrations(db)
@@ -71,9 +123,28 @@ func main() {
 	// Initialize repositories
 	userRepo := userrepo.NewPostgresUserRepository(db)
 	fileRepo := filerepo.NewPostgresFileRepository(db)
+	blobDeletionRepo := blobdeletionrepo.NewPostgresBlobDeletionRepository(db)
+	lifecyclePolicyRepo := lifecyclerepo.NewPostgresLifecyclePolicyRepository(db)
+	thumbnailRepo := thumbnailrepo.NewPostgresThumbnailRepository(db)
+	retentionRepo := retentionrepo.NewPostgresRetentionRepository(db)
+	accessLogRepo := accesslogrepo.NewPostgresShareAccessLogRepository(db)
+	refreshTokenRepo := tokenrepo.NewPostgresRefreshTokenRepository(db)
+	sessionRepo := sessionrepo.NewPostgresSessionRepository(db)
+	apiTokenRepo := apitokenrepo.NewPostgresAPITokenRepository(db)
+	recoveryCodeRepo := recoverycoderepo.NewPostgresRecoveryCodeRepository(db)
+	userTokenRepo := usertokenrepo.NewPostgresUserTokenRepository(db)
+	identityRepo := identityrepo.NewPostgresUserIdentityRepository(db)
+	jobRepo := jobrepo.NewPostgresJobRepository(db)
+	scheduledTaskRepo := schedulerepo.NewPostgresScheduledTaskRepository(db)
 
-	// Create JWT maker
+	// Create JWT maker, signing with the asymmetric keyring when one is configured
 	jwtMaker := jwt.NewJWTMaker(os.Getenv("JWT_SECRET"))
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		jwtMaker, err = jwt.NewKeyringMaker(keysDir, os.Getenv("JWT_ACTIVE_KID"), os.Getenv("JWT_ISSUER"))
+		if err != nil {
+			log.Fatalf("Error loading JWT signing keys: %v", err)
+		}
+	}
 
 	// Initialize local storage
 	storagePath := os.Getenv("STORAGE_PATH")
@@ -82,22 +153,242 @@ func main() {
 		log.Fatalf("Error initializing local storage: %v", err)
 	}
 
+	// Initialize mailer
+	var mail ports.Mailer
+	mailFrom := os.Getenv("MAIL_FROM")
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		mail = mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	case "file":
+		mail, err = mailer.NewFileMailer(os.Getenv("MAIL_DIR"), mailFrom)
+		if err != nil {
+			log.Fatalf("Error initializing file mailer: %v", err)
+		}
+	default:
+		mail = mailer.NewLogMailer()
+	}
+
+	// Initialize malware scanner. Uploads can't be shared or downloaded
+	// until scanned; without SCANNER=clamd they are passed unchecked.
+	var fileScanner ports.Scanner
+	switch os.Getenv("SCANNER") {
+	case "clamd":
+		scanTimeout := 2 * time.Minute
+		if raw := os.Getenv("CLAMD_TIMEOUT"); raw != "" {
+			scanTimeout, err = time.ParseDuration(raw)
+			if err != nil || scanTimeout <= 0 {
+				log.Fatalf("Invalid CLAMD_TIMEOUT: %q", raw)
+			}
+		}
+		clamd := scanner.NewClamdScanner(os.Getenv("CLAMD_ADDR"), scanTimeout)
+		if err := clamd.Ping(context.Background()); err != nil {
+			log.Printf("Warning: clamd is not reachable, uploads stay pending until it is: %v", err)
+		}
+		fileScanner = clamd
+	default:
+		fileScanner = scanner.NewNoopScanner()
+	}
+
 	// Initialize services
-	authService := authsrv.NewAuthService(userRepo, jwtMaker)
+	appURL := os.Getenv("APP_URL")
+	authService := authsrv.NewAuthService(userRepo, refreshTokenRepo, sessionRepo, recoveryCodeRepo, userTokenRepo, jwtMaker, redisCache, mail, appURL)
+	apiTokenService := apitokensrv.NewAPITokenService(apiTokenRepo, userRepo)
+
+	// OIDC_PROVIDERS is a JSON array of oidc.Config
+	var oidcConfigs []oidc.Config
+	if raw := os.Getenv("OIDC_PROVIDERS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &oidcConfigs); err != nil {
+			log.Fatalf("Error parsing OIDC_PROVIDERS: %v", err)
+		}
+	}
+	var oidcProviders []*oidc.Provider
+	for _, config := range oidcConfigs {
+		oidcProviders = append(oidcProviders, oidc.NewProvider(config))
+	}
+	oidcService := oidcsrv.NewOIDCService(oidcProviders, userRepo, identityRepo, authService, redisCache)
 	baseURL := "http://api:8080/files"
-	fileService := filesrv.NewFileService(fileRepo, localStorage, baseURL, redisCache)
+	// Anyone who knows the secret can mint upload URLs for any user
+	uploadSecret := os.Getenv("UPLOAD_SIGNING_SECRET")
+	if len(uploadSecret) < minUploadSecretLength {
+		log.Fatalf("UPLOAD_SIGNING_SECRET must be set to at least %d random characters, e.g. from `openssl rand -hex 32`", minUploadSecretLength)
+	}
+	uploadSigner := presign.NewSigner(uploadSecret)
+	// Users without an individual quota get this many bytes, 1 GiB by default
+	defaultQuota := int64(1 << 30)
+	if raw := os.Getenv("STORAGE_QUOTA_BYTES"); raw != "" {
+		defaultQuota, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid STORAGE_QUOTA_BYTES: %v", err)
+		}
+	}
+	uploadPolicy := domain.UploadPolicy{
+		MaxSize:      100 << 20,
+		AllowedTypes: splitList(os.Getenv("UPLOAD_ALLOWED_TYPES")),
+		DeniedTypes:  domain.DefaultDeniedTypes,
+	}
+	if raw := os.Getenv("UPLOAD_MAX_BYTES"); raw != "" {
+		uploadPolicy.MaxSize, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_MAX_BYTES: %v", err)
+		}
+	}
+	if raw, ok := os.LookupEnv("UPLOAD_DENIED_TYPES"); ok {
+		uploadPolicy.DeniedTypes = splitList(raw)
+	}
+	// Files no lifecycle policy covers expire after DEFAULT_RETENTION, e.g.
+	// "30d" (the default), "24h" or "never"
+	defaultRetention := 30 * 24 * time.Hour
+	if raw := os.Getenv("DEFAULT_RETENTION"); raw != "" {
+		retention, err := domain.ParseRetention(raw)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_RETENTION: %v", err)
+		}
+		defaultRetention = retention.Duration
+	}
+	jobService := jobsrv.NewJobService(jobRepo)
+	fileService := filesrv.NewFileService(fileRepo, userRepo, blobDeletionRepo, lifecyclePolicyRepo, thumbnailRepo, jobService, authService, fileScanner, mail, localStorage, baseURL, redisCache, uploadSigner, defaultQuota, uploadPolicy, defaultRetention)
+	shareService := sharesrv.NewShareService(fileRepo, accessLogRepo, localStorage, baseURL)
+	adminService := adminsrv.NewAdminService(userRepo, fileRepo, authService, fileService)
+	retentionService := retentionsrv.NewRetentionService(retentionRepo, fileRepo, userRepo, fileService)
+	accountService := accountsrv.NewAccountService(userRepo, fileRepo, apiTokenRepo, sessionRepo, localStorage, authService, fileService)
+
+	// Queued jobs run on every replica, with JOB_WORKERS workers each
+	jobService.Register(domain.JobFileUploaded, jobsrv.Handle(fileService.ProcessUpload))
+	jobWorkers := 4
+	if raw := os.Getenv("JOB_WORKERS"); raw != "" {
+		jobWorkers, err = strconv.Atoi(raw)
+		if err != nil || jobWorkers < 0 {
+			log.Fatalf("Invalid JOB_WORKERS: %q", raw)
+		}
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		jobService.Start(jobsCtx, jobWorkers, time.Second)
+	}()
+
+	// Maintenance tasks run on cron schedules in SCHEDULE_TIMEZONE (local
+	// time by default). Each default can be changed with
+	// TASK_<NAME>_SCHEDULE and TASK_<NAME>_ENABLED, and at runtime through
+	// /admin/tasks.
+	scheduleLocation := time.Local
+	if raw := os.Getenv("SCHEDULE_TIMEZONE"); raw != "" {
+		scheduleLocation, err = time.LoadLocation(raw)
+		if err != nil {
+			log.Fatalf("Invalid SCHEDULE_TIMEZONE: %v", err)
+		}
+	}
+	schedulerService := schedulersrv.NewSchedulerService(scheduledTaskRepo, scheduleLocation)
+	cleanupService := cleanupservice.NewCleanupService(fileRepo, blobDeletionRepo, localStorage)
+
+	// Owners are warned EXPIRY_NOTICE before files expire, 3 days by default
+	// and never if empty
+	expiryNotice := 3 * 24 * time.Hour
+	if raw, ok := os.LookupEnv("EXPIRY_NOTICE"); ok {
+		expiryNotice = 0
+		if raw != "" {
+			notice, err := domain.ParseRetention(raw)
+			if err != nil || notice.Never {
+				log.Fatalf("Invalid EXPIRY_NOTICE: %q", raw)
+			}
+			expiryNotice = notice.Duration
+		}
+	}
+	lifecycleService := lifecyclesrv.NewLifecycleService(fileRepo, lifecyclePolicyRepo, userRepo, localStorage, fileService, mail, defaultRetention, expiryNotice)
+	scrubService := scrubsrv.NewScrubService(fileRepo, thumbnailRepo, localStorage)
+	scrubOptions := domain.ScrubOptions{Quarantine: os.Getenv("SCRUB_QUARANTINE") == "true"}
 
-	// Initialize and start cleanup service, (10 seconds for testing)
-	cleanupService := cleanupservice.NewCleanupService(fileRepo, "./tmp", 10*time.Second)
+	tasks := []schedulersrv.Task{
+		{
+			Name:        "expired_files",
+			Description: "Delete files past their expiration date",
+			Schedule:    "0 3 * * *",
+			Enabled:     true,
+			Run:         cleanupService.DeleteExpiredFiles,
+		},
+		{
+			Name:        "expired_shares",
+			Description: "Delete share links that expired more than 30 days ago",
+			Schedule:    "30 3 * * *",
+			Enabled:     true,
+			Run:         cleanupService.DeleteExpiredShares,
+		},
+		{
+			Name:        "blob_deletions",
+			Description: "Remove blobs of deleted and moved files from storage",
+			Schedule:    "* * * * *",
+			Enabled:     true,
+			Run:         cleanupService.ProcessBlobDeletions,
+		},
+		{
+			Name:        "unprocessed_files",
+			Description: "Queue scans of uploads whose processing job was lost",
+			Schedule:    "*/15 * * * *",
+			Enabled:     true,
+			Run:         fileService.RequeueUnprocessed,
+		},
+		{
+			Name:        "lifecycle",
+			Description: "Apply lifecycle policies and send expiry notices",
+			Schedule:    "@hourly",
+			Enabled:     true,
+			Run:         lifecycleService.Apply,
+		},
+		{
+			Name:        "scrub",
+			Description: "Check storage for missing, corrupt and orphaned blobs",
+			Schedule:    "0 4 * * *",
+			Enabled:     true,
+			Run: func(ctx context.Context) error {
+				return scrubService.Run(ctx, scrubOptions)
+			},
+		},
+	}
+	for _, task := range tasks {
+		task.Schedule, task.Enabled = taskConfig(task.Name, task.Schedule, task.Enabled)
+		if err := schedulerService.Register(task); err != nil {
+			log.Fatalf("Invalid TASK_%s_SCHEDULE: %v", strings.ToUpper(task.Name), err)
+		}
+	}
+
+	// The scheduler runs only on the replica elected leader. The leader holds
+	// a lease of LEADER_LEASE_TTL in Redis; a replica takes over at most that
+	// long after the leader dies
+	leaseTTL := 15 * time.Second
+	if raw := os.Getenv("LEADER_LEASE_TTL"); raw != "" {
+		leaseTTL, err = time.ParseDuration(raw)
+		if err != nil || leaseTTL < time.Second {
+			log.Fatalf("Invalid LEADER_LEASE_TTL: %q", raw)
+		}
+	}
+	elector := leader.NewElector(redisCache, "scheduler", leaseTTL)
+	electorDone := make(chan struct{})
 	go func() {
-		cleanupService.Start(context.Background())
+		defer close(electorDone)
+		elector.Run(jobsCtx, func(ctx context.Context) {
+			schedulerService.Start(ctx, 5*time.Second)
+		})
 	}()
 
+	// Initialize auth middleware
+	authenticator := middleware.NewAuthenticator(jwtMaker, authService, apiTokenService, authService, authService)
+
 	// Initialize handlers
 	authHandler := authhdl.NewAuthHandler(authService)
+	apiTokenHandler := apitokenhdl.NewAPITokenHandler(apiTokenService)
+	oidcHandler := oidchdl.NewOIDCHandler(oidcService)
 
 	// Initialize handlers
 	fileHandler := filehdl.NewFileHandler(fileService)
+	shareHandler := sharehdl.NewShareHandler(shareService)
+	adminHandler := adminhdl.NewAdminHandler(adminService)
+	accountHandler := accounthdl.NewAccountHandler(accountService, authService)
+	lifecycleHandler := lifecyclehdl.NewLifecycleHandler(lifecycleService)
+	retentionHandler := retentionhdl.NewRetentionHandler(retentionService)
+	jobHandler := jobhdl.NewJobHandler(jobService)
+	schedulerHandler := schedulerhdl.NewSchedulerHandler(schedulerService)
 	router := http.NewServeMux()
 
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -106,16 +397,87 @@ func main() {
 	})
 
 	// Define routes
+	router.HandleFunc("/.well-known/jwks.json", middleware.ErrorHandler(authHandler.JWKS))
 	router.HandleFunc("/register", middleware.ErrorHandler(authHandler.Register))
 	router.HandleFunc("/login", middleware.ErrorHandler(authHandler.Login))
+	router.HandleFunc("/login/2fa", middleware.ErrorHandler(authHandler.CompleteLogin))
+	router.HandleFunc("/token/refresh", middleware.ErrorHandler(authHandler.Refresh))
+	router.HandleFunc("/oidc/providers", middleware.ErrorHandler(oidcHandler.Providers))
+	router.HandleFunc("/oidc/login", middleware.ErrorHandler(oidcHandler.Login))
+	router.HandleFunc("/oidc/callback", middleware.ErrorHandler(oidcHandler.Callback))
+	router.HandleFunc("/verify-email", middleware.ErrorHandler(authHandler.VerifyEmail))
+	router.HandleFunc("/password/forgot", middleware.ErrorHandler(authHandler.ForgotPassword))
+	router.HandleFunc("/password/reset", middleware.ErrorHandler(authHandler.ResetPassword))
+	router.HandleFunc("/account/unlock", middleware.ErrorHandler(authHandler.UnlockAccount))
+	router.HandleFunc("/account/email/confirm", middleware.ErrorHandler(accountHandler.ConfirmEmailChange))
+	router.HandleFunc("/files/direct-upload", middleware.ErrorHandler(fileHandler.DirectUpload))
+	router.HandleFunc("/files/share/", middleware.ErrorHandler(shareHandler.Download))
 
 	// Define Protedted routes
-	router.HandleFunc("/me", middleware.AuthMiddleware(middleware.ErrorHandler(authHandler.Me)))
-	router.HandleFunc("/upload", middleware.AuthMiddleware(middleware.ErrorHandler(fileHandler.Upload)))
-	router.HandleFunc("/files", middleware.AuthMiddleware(middleware.ErrorHandler(fileHandler.GetFiles)))
-	router.HandleFunc("/share", middleware.AuthMiddleware(middleware.ErrorHandler(fileHandler.ShareFile)))
-	router.HandleFunc("/files/search", middleware.AuthMiddleware(middleware.ErrorHandler(fileHandler.SearchFiles)))
-	router.HandleFunc("/file", middleware.AuthMiddleware(middleware.ErrorHandler(fileHandler.GetFile)))
+	router.HandleFunc("/me", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.Me)))
+	router.HandleFunc("/verify-email/resend", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.ResendVerificationEmail)))
+	router.HandleFunc("/logout", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.Logout)))
+	router.HandleFunc("/account/password", authenticator.AuthMiddleware(middleware.ErrorHandler(accountHandler.ChangePassword)))
+	router.HandleFunc("/account/email", authenticator.AuthMiddleware(middleware.ErrorHandler(accountHandler.ChangeEmail)))
+	router.HandleFunc("/account/export", authenticator.AuthMiddleware(middleware.ErrorHandler(accountHandler.Export)))
+	router.HandleFunc("/account/delete", authenticator.AuthMiddleware(middleware.ErrorHandler(accountHandler.DeleteAccount)))
+	router.HandleFunc("/me/usage", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.GetUsage), domain.ScopeFilesRead))
+	router.HandleFunc("/sessions", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.ListSessions)))
+	router.HandleFunc("/sessions/revoke", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.RevokeSession)))
+	router.HandleFunc("/logout/all", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.LogoutAll)))
+	router.HandleFunc("/2fa/enroll", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.EnrollTOTP)))
+	router.HandleFunc("/2fa/confirm", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.ConfirmTOTP)))
+	router.HandleFunc("/2fa/disable", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.DisableTOTP)))
+	router.HandleFunc("/2fa/recovery-codes", authenticator.AuthMiddleware(middleware.ErrorHandler(authHandler.RegenerateRecoveryCodes)))
+	router.HandleFunc("/tokens", authenticator.AuthMiddleware(middleware.ErrorHandler(apiTokenHandler.List)))
+	router.HandleFunc("/tokens/create", authenticator.AuthMiddleware(middleware.ErrorHandler(apiTokenHandler.Create)))
+	router.HandleFunc("/tokens/revoke", authenticator.AuthMiddleware(middleware.ErrorHandler(apiTokenHandler.Revoke)))
+
+	// Routes that also accept API tokens carrying the listed scopes
+	router.HandleFunc("/upload", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.Upload), domain.ScopeFilesWrite))
+	router.HandleFunc("/upload/presign", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.PresignUpload), domain.ScopeFilesWrite))
+	router.HandleFunc("/files", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.GetFiles), domain.ScopeFilesRead))
+	router.HandleFunc("/share", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.ShareFile), domain.ScopeShareCreate))
+	router.HandleFunc("/files/search", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.SearchFiles), domain.ScopeFilesRead))
+	router.HandleFunc("/file", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.GetFile), domain.ScopeFilesRead))
+	router.HandleFunc("/share/access-log", authenticator.AuthMiddleware(middleware.ErrorHandler(shareHandler.ShareAccessLog), domain.ScopeFilesRead))
+	router.HandleFunc("/file/thumbnail", authenticator.AuthMiddleware(middleware.ErrorHandler(fileHandler.Thumbnail), domain.ScopeFilesRead))
+	router.HandleFunc("/file/access-log", authenticator.AuthMiddleware(middleware.ErrorHandler(shareHandler.FileAccessLog), domain.ScopeFilesRead))
+	router.HandleFunc("/lifecycle/policies", authenticator.AuthMiddleware(middleware.ErrorHandler(lifecycleHandler.ListPolicies), domain.ScopeFilesRead))
+	router.HandleFunc("/lifecycle/policies/create", authenticator.AuthMiddleware(middleware.ErrorHandler(lifecycleHandler.CreatePolicy), domain.ScopeFilesWrite))
+	router.HandleFunc("/lifecycle/policies/delete", authenticator.AuthMiddleware(middleware.ErrorHandler(lifecycleHandler.DeletePolicy), domain.ScopeFilesWrite))
+	router.HandleFunc("/lifecycle/preview", authenticator.AuthMiddleware(middleware.ErrorHandler(lifecycleHandler.Preview), domain.ScopeFilesRead))
+
+	// Define admin routes, all guarded by the admin middleware
+	adminRouter := http.NewServeMux()
+	adminRouter.HandleFunc("/admin/users", middleware.ErrorHandler(adminHandler.ListUsers))
+	adminRouter.HandleFunc("/admin/users/disable", middleware.ErrorHandler(adminHandler.DisableUser))
+	adminRouter.HandleFunc("/admin/users/enable", middleware.ErrorHandler(adminHandler.EnableUser))
+	adminRouter.HandleFunc("/admin/users/unlock", middleware.ErrorHandler(adminHandler.UnlockUser))
+	adminRouter.HandleFunc("/admin/users/reset-password", middleware.ErrorHandler(adminHandler.ResetPassword))
+	adminRouter.HandleFunc("/admin/users/files", middleware.ErrorHandler(adminHandler.GetUserFiles))
+	adminRouter.HandleFunc("/admin/users/files/delete", middleware.ErrorHandler(adminHandler.DeleteUserFiles))
+	adminRouter.HandleFunc("/admin/users/usage", middleware.ErrorHandler(adminHandler.GetUserUsage))
+	adminRouter.HandleFunc("/admin/users/quota", middleware.ErrorHandler(adminHandler.SetUserQuota))
+	adminRouter.HandleFunc("/admin/files/delete", middleware.ErrorHandler(adminHandler.DeleteFile))
+	adminRouter.HandleFunc("/admin/lifecycle/policies", middleware.ErrorHandler(lifecycleHandler.ListGlobalPolicies))
+	adminRouter.HandleFunc("/admin/lifecycle/policies/create", middleware.ErrorHandler(lifecycleHandler.CreateGlobalPolicy))
+	adminRouter.HandleFunc("/admin/lifecycle/policies/delete", middleware.ErrorHandler(lifecycleHandler.DeleteGlobalPolicy))
+	adminRouter.HandleFunc("/admin/lifecycle/preview", middleware.ErrorHandler(lifecycleHandler.AdminPreview))
+	adminRouter.HandleFunc("/admin/holds/file", middleware.ErrorHandler(retentionHandler.HoldFile))
+	adminRouter.HandleFunc("/admin/holds/file/release", middleware.ErrorHandler(retentionHandler.ReleaseFile))
+	adminRouter.HandleFunc("/admin/holds/user", middleware.ErrorHandler(retentionHandler.HoldUser))
+	adminRouter.HandleFunc("/admin/holds/user/release", middleware.ErrorHandler(retentionHandler.ReleaseUser))
+	adminRouter.HandleFunc("/admin/retention", middleware.ErrorHandler(retentionHandler.ExtendRetention))
+	adminRouter.HandleFunc("/admin/retention/events", middleware.ErrorHandler(retentionHandler.Events))
+	adminRouter.HandleFunc("/admin/jobs", middleware.ErrorHandler(jobHandler.ListJobs))
+	adminRouter.HandleFunc("/admin/jobs/get", middleware.ErrorHandler(jobHandler.GetJob))
+	adminRouter.HandleFunc("/admin/jobs/retry", middleware.ErrorHandler(jobHandler.RetryJob))
+	adminRouter.HandleFunc("/admin/tasks", middleware.ErrorHandler(schedulerHandler.ListTasks))
+	adminRouter.HandleFunc("/admin/tasks/get", middleware.ErrorHandler(schedulerHandler.GetTask))
+	adminRouter.HandleFunc("/admin/tasks/update", middleware.ErrorHandler(schedulerHandler.UpdateTask))
+	adminRouter.HandleFunc("/admin/tasks/run", middleware.ErrorHandler(schedulerHandler.RunTask))
+	router.Handle("/admin/", authenticator.AdminMiddleware(adminRouter))
 
 	// Define routes
 	srv := &http.Server{
@@ -144,5 +506,101 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Stop the jobs and hand the lease over to another replica. Queued jobs
+	// cut short are picked up again once their lock expires.
+	stopJobs()
+	select {
+	case <-electorDone:
+	case <-ctx.Done():
+		log.Println("Scheduled jobs did not stop in time")
+	}
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		log.Println("Job workers did not stop in time")
+	}
+
 	log.Println("Server exiting")
 }
+
+// legacyIntervals are the variables that ran tasks at a fixed interval before
+// they were scheduled. They are still honoured, with 0 disabling the task.
+var legacyIntervals = map[string]string{
+	"lifecycle": "LIFECYCLE_INTERVAL",
+	"scrub":     "SCRUB_INTERVAL",
+}
+
+// taskConfig applies a legacy interval variable, then the
+// TASK_<NAME>_SCHEDULE and TASK_<NAME>_ENABLED overrides, to a task's
+// defaults.
+func taskConfig(name, schedule string, enabled bool) (string, bool) {
+	prefix := "TASK_" + strings.ToUpper(name)
+	if legacy, ok := legacyIntervals[name]; ok {
+		if raw := os.Getenv(legacy); raw != "" {
+			interval, err := time.ParseDuration(raw)
+			if err != nil || interval < 0 {
+				log.Fatalf("Invalid %s: %q", legacy, raw)
+			}
+			if interval == 0 {
+				enabled = false
+			} else {
+				schedule = "@every " + interval.String()
+			}
+			log.Printf("%s is deprecated, use %s_SCHEDULE and %s_ENABLED instead", legacy, prefix, prefix)
+		}
+	}
+	if raw := os.Getenv(prefix + "_SCHEDULE"); raw != "" {
+		schedule = raw
+	}
+	if raw := os.Getenv(prefix + "_ENABLED"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("Invalid %s_ENABLED: %q", prefix, raw)
+		}
+		enabled = value
+	}
+	return schedule, enabled
+}
+
+// splitList parses a comma-separated environment value, ignoring blanks.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runFsck scrubs storage once, writes the report to stdout as JSON and
+// returns 1 if any missing or corrupt files or orphaned blobs were found.
+func runFsck(db *sql.DB, args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	quarantine := flags.Bool("quarantine", false, "move orphaned and corrupt blobs to the quarantine directory")
+	repair := flags.Bool("repair", false, "record missing checksums and remove stale temp files")
+	flags.Parse(args)
+
+	localStorage, err := storage.NewLocalStorage(os.Getenv("STORAGE_PATH"))
+	if err != nil {
+		log.Printf("Error initializing storage: %v", err)
+		return 2
+	}
+	scrubService := scrubsrv.NewScrubService(filerepo.NewPostgresFileRepository(db), thumbnailrepo.NewPostgresThumbnailRepository(db), localStorage)
+	report, err := scrubService.Scrub(context.Background(), domain.ScrubOptions{Quarantine: *quarantine, Repair: *repair})
+	if err != nil {
+		log.Printf("Error scrubbing storage: %v", err)
+		return 2
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("Error writing report: %v", err)
+		return 2
+	}
+	if report.Count(domain.ScrubIssueMissing)+report.Count(domain.ScrubIssueCorrupt)+report.Count(domain.ScrubIssueOrphan) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS share_access_logs (
+    id BIGSERIAL PRIMARY KEY,
+    shared_file_url_id INTEGER REFERENCES shared_file_urls(id) ON DELETE SET NULL,
+    file_id UUID REFERENCES files(id) ON DELETE SET NULL,
+    accessed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    bytes_served BIGINT NOT NULL DEFAULT 0,
+    success BOOLEAN NOT NULL,
+    denied_reason VARCHAR(50) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_access_logs_shared_file_url_id ON share_access_logs(shared_file_url_id);
+CREATE INDEX IF NOT EXISTS idx_share_access_logs_file_id ON share_access_logs(file_id);
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Deleting a file also removes its share links
+ALTER TABLE shared_file_urls DROP CONSTRAINT IF EXISTS shared_file_urls_file_id_fkey;
+ALTER TABLE shared_file_urls ADD CONSTRAINT shared_file_urls_file_id_fkey FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE;
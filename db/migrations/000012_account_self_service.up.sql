@@ -0,0 +1,6 @@
+-- Deleting a user removes their files and share links with them
+ALTER TABLE files DROP CONSTRAINT IF EXISTS files_user_id_fkey;
+ALTER TABLE files ADD CONSTRAINT files_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Address an emailed token was sent to, used to confirm email changes
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS email VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- storage_quota overrides the default quota when set; storage_used is kept in
+-- step with the files table so uploads can reserve space atomically
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_quota BIGINT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_used BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users u SET storage_used = COALESCE((SELECT SUM(size) FROM files f WHERE f.user_id = u.id), 0);
@@ -0,0 +1,2 @@
+-- MIME type detected from the file content; type keeps the name's extension
+ALTER TABLE files ADD COLUMN IF NOT EXISTS mime_type VARCHAR(255) NOT NULL DEFAULT 'application/octet-stream';
@@ -0,0 +1,2 @@
+-- SHA-256 of the stored content, computed while it was written
+ALTER TABLE files ADD COLUMN IF NOT EXISTS sha256 VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- Outbox of blobs to remove from storage. Rows are written in the same
+-- transaction as the metadata change and drained by the cleanup worker.
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    storage_key TEXT NOT NULL,
+    file_id UUID,
+    reason VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_blob_deletions_next_attempt_at ON blob_deletions(next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_blob_deletions_file_id ON blob_deletions(file_id);
@@ -0,0 +1,21 @@
+-- Expiration is now computed from lifecycle policies; NULL means never
+ALTER TABLE files ALTER COLUMN expiration_date DROP NOT NULL;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expiration_pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMP;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS last_accessed_at TIMESTAMP;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS storage_class VARCHAR(16) NOT NULL DEFAULT 'standard';
+
+CREATE INDEX IF NOT EXISTS idx_files_expiration_date ON files(expiration_date);
+
+CREATE TABLE IF NOT EXISTS lifecycle_policies (
+    id UUID PRIMARY KEY,
+    -- NULL for global policies managed by admins
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    file_type VARCHAR(100) NOT NULL DEFAULT '',
+    action VARCHAR(16) NOT NULL,
+    days INT NOT NULL DEFAULT 0,
+    basis VARCHAR(16) NOT NULL DEFAULT 'created',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_lifecycle_policies_user_id ON lifecycle_policies(user_id);
@@ -0,0 +1,64 @@
+-- Legal holds keep a file, or everything of a user, until released.
+-- retain_until locks a file against deletion and modification until then.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS retain_until TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Audit trail of hold and retention changes. There are no foreign keys so
+-- the trail outlives the files and users it describes.
+CREATE TABLE IF NOT EXISTS retention_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id UUID NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    file_id UUID,
+    user_id UUID,
+    retain_until TIMESTAMP,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_events_file_id ON retention_events(file_id);
+CREATE INDEX IF NOT EXISTS idx_retention_events_user_id ON retention_events(user_id);
+
+-- The application checks locks before deleting; these triggers make sure no
+-- path, including cascades from deleted users, gets around them.
+CREATE OR REPLACE FUNCTION enforce_file_retention() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.legal_hold OR OLD.retain_until > NOW()
+            OR EXISTS (SELECT 1 FROM users WHERE id = OLD.user_id AND legal_hold) THEN
+            RAISE EXCEPTION 'file % is under legal hold or retention', OLD.id;
+        END IF;
+        RETURN OLD;
+    END IF;
+
+    IF OLD.retain_until > NOW() AND (NEW.retain_until IS NULL OR NEW.retain_until < OLD.retain_until) THEN
+        RAISE EXCEPTION 'retention of file % can only be extended', OLD.id;
+    END IF;
+    IF (OLD.legal_hold OR OLD.retain_until > NOW())
+        AND (NEW.user_id <> OLD.user_id OR NEW.name <> OLD.name OR NEW.size <> OLD.size
+             OR (OLD.sha256 <> '' AND NEW.sha256 <> OLD.sha256)) THEN
+        RAISE EXCEPTION 'file % is locked', OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS files_enforce_retention ON files;
+CREATE TRIGGER files_enforce_retention
+    BEFORE UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION enforce_file_retention();
+
+CREATE OR REPLACE FUNCTION enforce_user_legal_hold() RETURNS trigger AS $$
+BEGIN
+    IF OLD.legal_hold THEN
+        RAISE EXCEPTION 'user % is under legal hold', OLD.id;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_enforce_legal_hold ON users;
+CREATE TRIGGER users_enforce_legal_hold
+    BEFORE DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION enforce_user_legal_hold();
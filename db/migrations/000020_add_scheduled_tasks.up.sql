@@ -0,0 +1,14 @@
+-- State of the maintenance tasks run by the scheduler. The tasks themselves
+-- are defined in code; a row holds an admin's overrides of their schedule
+-- and enabled flag (NULL keeps the configured default) and the last run.
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+    name VARCHAR(64) PRIMARY KEY,
+    schedule VARCHAR(255),
+    enabled BOOLEAN,
+    run_requested_at TIMESTAMP WITH TIME ZONE,
+    last_started_at TIMESTAMP WITH TIME ZONE,
+    last_finished_at TIMESTAMP WITH TIME ZONE,
+    last_status VARCHAR(16) NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
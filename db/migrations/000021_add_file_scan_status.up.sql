@@ -0,0 +1,6 @@
+-- New uploads wait for a malware scan before they can be shared or
+-- downloaded. Files uploaded before scanning existed count as clean.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_status VARCHAR(16) NOT NULL DEFAULT 'clean';
+ALTER TABLE files ALTER COLUMN scan_status SET DEFAULT 'pending';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_result TEXT NOT NULL DEFAULT '';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP;
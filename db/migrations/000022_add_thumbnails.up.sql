@@ -0,0 +1,13 @@
+-- Thumbnails of image files, one per file and size. Their blobs are queued
+-- for deletion with the file's own blob before the rows cascade away.
+CREATE TABLE IF NOT EXISTS thumbnails (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    size VARCHAR(16) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    bytes BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (file_id, size)
+);
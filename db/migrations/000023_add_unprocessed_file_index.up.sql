@@ -0,0 +1,4 @@
+-- Finds uploads still waiting for a scan and their processing jobs, so files
+-- whose job was never queued can be found and queued again.
+CREATE INDEX IF NOT EXISTS idx_files_scan_pending ON files(created_at) WHERE scan_status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_file_id ON jobs((payload->>'file_id'));
@@ -0,0 +1,7 @@
+-- Image files no thumbnail could be made of, so they are not decoded again
+-- on every request.
+CREATE TABLE IF NOT EXISTS thumbnail_failures (
+    file_id UUID PRIMARY KEY REFERENCES files(id) ON DELETE CASCADE,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
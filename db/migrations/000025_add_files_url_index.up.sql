@@ -0,0 +1,3 @@
+-- Claiming blob deletions checks whether a file still points at each key.
+-- A migration of its own so databases that already ran 000016 get it too.
+CREATE INDEX IF NOT EXISTS idx_files_url ON files(url);
@@ -0,0 +1,3 @@
+-- Where the blob of an infected file was moved, so deleting the file also
+-- removes the quarantined copy.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS quarantine_key TEXT;
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// AccountExport is the metadata included in a user's data export, next to
+// the content of their files.
+type AccountExport struct {
+	ExportedAt  time.Time        `json:"exported_at"`
+	User        *User            `json:"user"`
+	Files       []*File          `json:"files"`
+	SharedLinks []*SharedFileURL `json:"shared_links"`
+	APITokens   []*APIToken      `json:"api_tokens"`
+	Sessions    []*Session       `json:"sessions"`
+}
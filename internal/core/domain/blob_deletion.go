@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// BlobDeletionUpload guards a blob being uploaded. It is cancelled when
+	// the file row is committed, so it only runs if the upload never was.
+	BlobDeletionUpload = "upload"
+	// BlobDeletionFile removes the blob of a deleted file
+	BlobDeletionFile = "delete"
+	// BlobDeletionMoved removes the old copy of a blob moved to a new key
+	BlobDeletionMoved = "move"
+)
+
+// BlobDeletion is an outbox entry for a blob that must be removed from
+// storage.
+type BlobDeletion struct {
+	ID            int64      `json:"id"`
+	StorageKey    string     `json:"storage_key"`
+	FileID        *uuid.UUID `json:"file_id,omitempty"`
+	Reason        string     `json:"reason"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Referenced is set when a file row still points at the key, in which
+	// case the blob must be kept
+	Referenced bool `json:"referenced"`
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DirectUpload describes a presigned upload the client may PUT bytes to
+// without a bearer token.
+type DirectUpload struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Retention   string    `json:"retention,omitempty"`
+	UploadURL   string    `json:"upload_url"`
+	Method      string    `json:"method"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
@@ -1,19 +1,58 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+)
+
+var ErrFileNotFound = errors.New("file not found")
+
 type File struct {
-	ID             uuid.UUID `json:"id" validate:"required,uuid4"`
-	Name           string    `json:"name" validate:"required,min=1,max=255"`
-	Size           int64     `json:"size" validate:"required,gt=0"`
-	UserID         uuid.UUID `json:"user_id" validate:"required,uuid4"`
-	Type           string    `json:"type" validate:"required,min=1,max=255"`
-	URL            string    `json:"url" validate:"required,min=1,max=255"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	ExpirationDate time.Time `json:"expiration_date"`
+	ID           uuid.UUID `json:"id" validate:"required,uuid4"`
+	Name         string    `json:"name" validate:"required,min=1,max=255"`
+	Size         int64     `json:"size" validate:"required,gt=0"`
+	UserID       uuid.UUID `json:"user_id" validate:"required,uuid4"`
+	Type         string    `json:"type" validate:"required,min=1,max=255"`
+	MIMEType     string    `json:"mime_type"`
+	SHA256       string    `json:"sha256"`
+	URL          string    `json:"url" validate:"required,min=1,max=255"`
+	StorageClass string    `json:"storage_class"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// ExpirationDate is nil for files that never expire. A pinned date was
+	// set for the file itself and is not recomputed from lifecycle policies.
+	ExpirationDate   *time.Time `json:"expiration_date"`
+	ExpirationPinned bool       `json:"expiration_pinned"`
+	LastAccessedAt   *time.Time `json:"last_accessed_at,omitempty"`
+	// A file under legal hold or retained until a later date cannot be
+	// modified or deleted
+	LegalHold   bool       `json:"legal_hold"`
+	RetainUntil *time.Time `json:"retain_until,omitempty"`
+	// Only clean files can be shared or downloaded. ScanResult names the
+	// malware found in an infected file.
+	ScanStatus string     `json:"scan_status"`
+	ScanResult string     `json:"scan_result,omitempty"`
+	ScannedAt  *time.Time `json:"scanned_at,omitempty"`
+}
+
+type StorageUsage struct {
+	UserID     uuid.UUID   `json:"user_id"`
+	FileCount  int64       `json:"file_count"`
+	TotalBytes int64       `json:"total_bytes"`
+	QuotaBytes int64       `json:"quota_bytes"`
+	ByType     []TypeUsage `json:"by_type"`
+}
+
+type TypeUsage struct {
+	Type       string `json:"type"`
+	FileCount  int64  `json:"file_count"`
+	TotalBytes int64  `json:"total_bytes"`
 }
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	// JobStatusDead jobs failed permanently or ran out of attempts. They stay
+	// until an admin retries them.
+	JobStatusDead = "dead"
+)
+
+const (
+	// JobFileUploaded runs post-upload processing of a file, with a FileJob
+	// payload
+	JobFileUploaded = "file.uploaded"
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedBy    *string         `json:"locked_by,omitempty"`
+	LockedUntil *time.Time      `json:"locked_until,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+type JobSearchParams struct {
+	Status string
+	Type   string
+	Limit  int
+	Offset int
+}
+
+// FileJob is the payload of jobs about a single file.
+type FileJob struct {
+	FileID uuid.UUID `json:"file_id"`
+}
@@ -0,0 +1,186 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// LifecycleExpire deletes files Days after their basis time
+	LifecycleExpire = "expire"
+	// LifecycleNeverExpire keeps files until they are deleted explicitly
+	LifecycleNeverExpire = "never_expire"
+	// LifecycleColdTier moves files to the cold storage tier Days after their
+	// basis time
+	LifecycleColdTier = "cold_tier"
+
+	LifecycleBasisCreated    = "created"
+	LifecycleBasisLastAccess = "last_access"
+
+	StorageClassStandard = "standard"
+	StorageClassCold     = "cold"
+)
+
+// LifecyclePolicy decides when matching files expire or change tier. Global
+// policies have no UserID. FileType is empty for every file, an extension
+// (".pdf") or a MIME type, exact or wildcard ("image/*"). Files are stored
+// flat, without folders, so there is no folder scope.
+type LifecyclePolicy struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	FileType  string     `json:"file_type"`
+	Action    string     `json:"action"`
+	Days      int        `json:"days"`
+	Basis     string     `json:"basis"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (p *LifecyclePolicy) Matches(file *File) bool {
+	if p.UserID != nil && *p.UserID != file.UserID {
+		return false
+	}
+	switch {
+	case p.FileType == "":
+		return true
+	case strings.HasPrefix(p.FileType, "."):
+		return strings.EqualFold(p.FileType, file.Type)
+	default:
+		if prefix, ok := strings.CutSuffix(p.FileType, "/*"); ok {
+			return strings.HasPrefix(file.MIMEType, prefix+"/")
+		}
+		return p.FileType == file.MIMEType
+	}
+}
+
+// DueAt returns when the policy's action applies to file.
+func (p *LifecyclePolicy) DueAt(file *File) time.Time {
+	basis := file.CreatedAt
+	if p.Basis == LifecycleBasisLastAccess && file.LastAccessedAt != nil {
+		basis = *file.LastAccessedAt
+	}
+	return basis.AddDate(0, 0, p.Days)
+}
+
+// specificity ranks policies for the same file: a file type match beats a
+// catch-all, so an organisation-wide rule for a type outranks a user's
+// blanket rule, and a user's rule beats a global one of the same kind.
+func (p *LifecyclePolicy) specificity() int {
+	n := 0
+	if p.FileType != "" {
+		n += 2
+	}
+	if p.UserID != nil {
+		n++
+	}
+	return n
+}
+
+// SelectLifecyclePolicy returns the most specific policy with one of the
+// given actions that matches file, or nil. Ties go to the policy that keeps
+// the file longest.
+func SelectLifecyclePolicy(policies []*LifecyclePolicy, file *File, actions ...string) *LifecyclePolicy {
+	var selected *LifecyclePolicy
+	for _, p := range policies {
+		if !p.Matches(file) || !containsString(actions, p.Action) {
+			continue
+		}
+		if selected == nil || p.specificity() > selected.specificity() ||
+			(p.specificity() == selected.specificity() && keepsLonger(p, selected, file)) {
+			selected = p
+		}
+	}
+	return selected
+}
+
+func keepsLonger(p, than *LifecyclePolicy, file *File) bool {
+	if than.Action == LifecycleNeverExpire {
+		return false
+	}
+	return p.Action == LifecycleNeverExpire || p.DueAt(file).After(than.DueAt(file))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveExpiration returns when file expires under policies, nil for never.
+// Files with a pinned expiration keep it. Without a matching policy files
+// expire defaultRetention after creation, or never if it is zero.
+func ResolveExpiration(policies []*LifecyclePolicy, file *File, defaultRetention time.Duration) *time.Time {
+	if file.ExpirationPinned {
+		return file.ExpirationDate
+	}
+	policy := SelectLifecyclePolicy(policies, file, LifecycleExpire, LifecycleNeverExpire)
+	switch {
+	case policy != nil && policy.Action == LifecycleNeverExpire:
+		return nil
+	case policy != nil:
+		due := policy.DueAt(file)
+		return &due
+	case defaultRetention > 0:
+		due := file.CreatedAt.Add(defaultRetention)
+		return &due
+	}
+	return nil
+}
+
+// Retention overrides the lifecycle policies for a single upload.
+type Retention struct {
+	Duration time.Duration
+	Never    bool
+}
+
+var ErrInvalidRetention = errors.New(`retention must be "never", a number of days like "7d" or a duration like "24h"`)
+
+// ParseRetention parses "never", "<n>d" or a Go duration.
+func ParseRetention(raw string) (*Retention, error) {
+	if raw == "never" {
+		return &Retention{Never: true}, nil
+	}
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return nil, ErrInvalidRetention
+		}
+		return &Retention{Duration: time.Duration(n) * 24 * time.Hour}, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return nil, ErrInvalidRetention
+	}
+	return &Retention{Duration: d}, nil
+}
+
+func (r *Retention) String() string {
+	if r.Never {
+		return "never"
+	}
+	return r.Duration.String()
+}
+
+// LifecycleItem is one file a lifecycle run would act on.
+type LifecycleItem struct {
+	FileID   uuid.UUID  `json:"file_id"`
+	UserID   uuid.UUID  `json:"user_id"`
+	Name     string     `json:"name"`
+	Size     int64      `json:"size"`
+	At       time.Time  `json:"at"`
+	PolicyID *uuid.UUID `json:"policy_id,omitempty"`
+}
+
+// LifecycleReport lists what lifecycle processing will do up to Until.
+type LifecycleReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Until       time.Time       `json:"until"`
+	Deletions   []LifecycleItem `json:"deletions"`
+	Transitions []LifecycleItem `json:"transitions"`
+}
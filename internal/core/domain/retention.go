@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RetentionHoldPlaced   = "hold_placed"
+	RetentionHoldReleased = "hold_released"
+	RetentionExtended     = "retention_extended"
+)
+
+// RetentionEvent is an audit record of a legal hold or retention change on
+// a file or on all files of a user.
+type RetentionEvent struct {
+	ID          int64      `json:"id"`
+	ActorID     uuid.UUID  `json:"actor_id"`
+	Action      string     `json:"action"`
+	FileID      *uuid.UUID `json:"file_id,omitempty"`
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+	RetainUntil *time.Time `json:"retain_until,omitempty"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Locked reports whether the file itself is held or retained at now. Holds
+// on the owner are not visible here.
+func (f *File) Locked(now time.Time) bool {
+	return f.LegalHold || (f.RetainUntil != nil && f.RetainUntil.After(now))
+}
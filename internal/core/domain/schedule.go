@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+const (
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+)
+
+// ScheduledTask is a maintenance task as seen by admins: its effective
+// configuration and the outcome of its last run.
+type ScheduledTask struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Schedule    string `json:"schedule"`
+	Enabled     bool   `json:"enabled"`
+	// Overridden is set when an admin changed the schedule or enabled flag
+	Overridden     bool       `json:"overridden"`
+	RunRequestedAt *time.Time `json:"run_requested_at,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// TaskUpdate changes a task's configuration. Nil fields are left as they
+// are; Reset drops all earlier overrides first.
+type TaskUpdate struct {
+	Schedule *string `json:"schedule"`
+	Enabled  *bool   `json:"enabled"`
+	Reset    bool    `json:"reset"`
+}
+
+// TaskState is the stored part of a scheduled task. Nil Schedule and
+// Enabled keep the defaults the task was registered with.
+type TaskState struct {
+	Name           string
+	Schedule       *string
+	Enabled        *bool
+	RunRequestedAt *time.Time
+	LastStartedAt  *time.Time
+	LastFinishedAt *time.Time
+	LastStatus     string
+	LastError      string
+}
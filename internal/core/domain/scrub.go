@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScrubIssueMissing    = "missing"
+	ScrubIssueCorrupt    = "corrupt"
+	ScrubIssueOrphan     = "orphan"
+	ScrubIssueUnverified = "unverified"
+	ScrubIssueStaleTemp  = "stale_temp"
+)
+
+// ScrubOptions control what the storage scrubber may change. With neither
+// set it only reports.
+type ScrubOptions struct {
+	// Quarantine moves orphaned and corrupt blobs out of the served tree
+	Quarantine bool `json:"quarantine"`
+	// Repair records checksums of files that have none and removes stale
+	// temp files left by interrupted uploads
+	Repair bool `json:"repair"`
+}
+
+type ScrubIssue struct {
+	Kind   string     `json:"kind"`
+	FileID *uuid.UUID `json:"file_id,omitempty"`
+	Key    string     `json:"key"`
+	Detail string     `json:"detail,omitempty"`
+	// Action is what the scrubber did about the issue, if anything
+	Action string `json:"action,omitempty"`
+}
+
+type ScrubReport struct {
+	StartedAt    time.Time    `json:"started_at"`
+	FinishedAt   time.Time    `json:"finished_at"`
+	Options      ScrubOptions `json:"options"`
+	FilesChecked int          `json:"files_checked"`
+	BlobsChecked int          `json:"blobs_checked"`
+	Issues       []ScrubIssue `json:"issues"`
+}
+
+// Count returns the number of issues of the given kind.
+func (r *ScrubReport) Count(kind string) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
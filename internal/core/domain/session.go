@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one sign-in of a user on a device. Refresh tokens rotated from
+// that sign-in and the access tokens they mint all belong to it.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Current    bool       `json:"current"`
+}
+
+// ClientInfo describes the client a sign-in request came from.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ShareDeniedNotFound    = "not_found"
+	ShareDeniedExpired     = "expired"
+	ShareDeniedFileMissing = "file_missing"
+	// The file is awaiting its malware scan or was found infected
+	ShareDeniedNotClean = "not_clean"
+)
+
+type ShareAccessLog struct {
+	ID              int64      `json:"id"`
+	SharedFileURLID *int64     `json:"shared_file_url_id,omitempty"`
+	FileID          *uuid.UUID `json:"file_id,omitempty"`
+	AccessedAt      time.Time  `json:"accessed_at"`
+	IPAddress       string     `json:"ip_address"`
+	UserAgent       string     `json:"user_agent"`
+	BytesServed     int64      `json:"bytes_served"`
+	Success         bool       `json:"success"`
+	DeniedReason    string     `json:"denied_reason,omitempty"`
+}
+
+type ShareAccessStats struct {
+	TotalAccesses   int64      `json:"total_accesses"`
+	SuccessCount    int64      `json:"success_count"`
+	DeniedCount     int64      `json:"denied_count"`
+	UniqueIPs       int64      `json:"unique_ips"`
+	BytesServed     int64      `json:"bytes_served"`
+	FirstAccessedAt *time.Time `json:"first_accessed_at,omitempty"`
+	LastAccessedAt  *time.Time `json:"last_accessed_at,omitempty"`
+}
+
+type AccessLogParams struct {
+	Limit  int
+	Offset int
+}
+
+type ShareAccessReport struct {
+	Stats   ShareAccessStats  `json:"stats"`
+	History []*ShareAccessLog `json:"history"`
+}
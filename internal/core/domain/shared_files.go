@@ -7,6 +7,7 @@ import (
 )
 
 type SharedFileURL struct {
+	ID        int64     `json:"id"`
 	FileID    uuid.UUID `json:"file_id"`
 	URL       string    `json:"url"`
 	ExpiresAt time.Time `json:"expires_at"`
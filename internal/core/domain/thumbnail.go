@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThumbnailSizes maps each thumbnail size to the longest side, in pixels,
+// of the images generated for it.
+var ThumbnailSizes = map[string]int{
+	"small":  128,
+	"medium": 256,
+	"large":  512,
+}
+
+// ThumbnailMIMETypes are the file types thumbnails are generated for
+var ThumbnailMIMETypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Thumbnail is a scaled-down preview of an image file, stored as a blob of
+// its own and removed together with the file.
+type Thumbnail struct {
+	FileID     uuid.UUID `json:"file_id"`
+	Size       string    `json:"size"`
+	StorageKey string    `json:"-"`
+	MIMEType   string    `json:"mime_type"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Bytes      int64     `json:"bytes"`
+	CreatedAt  time.Time `json:"created_at"`
+}
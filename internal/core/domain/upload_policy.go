@@ -0,0 +1,19 @@
+package domain
+
+// UploadPolicy limits what may be uploaded. Types are MIME types detected
+// from the content, either exact ("application/pdf") or wildcards ("image/*").
+// An empty AllowedTypes list allows every type that is not denied.
+type UploadPolicy struct {
+	MaxSize      int64
+	AllowedTypes []string
+	DeniedTypes  []string
+}
+
+// DefaultDeniedTypes are native executables, which are never served back
+// safely to other users.
+var DefaultDeniedTypes = []string{
+	"application/vnd.microsoft.portable-executable",
+	"application/x-elf",
+	"application/x-mach-binary",
+	"application/x-msi",
+}
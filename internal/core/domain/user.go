@@ -1,15 +1,36 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
 type User struct {
-	ID        uuid.UUID `json:"id" validate:"required,uuid4"`
-	Email     string    `json:"email" validate:"required,email"`
-	Password  string    `json:"-" validate:"required,min=8"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id" validate:"required,uuid4"`
+	Email         string    `json:"email" validate:"required,email"`
+	Password      string    `json:"-" validate:"required,min=8"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	Disabled      bool      `json:"disabled"`
+	StorageQuota  *int64    `json:"storage_quota,omitempty"`
+	TOTPSecret    string    `json:"-"`
+	TOTPEnabled   bool      `json:"totp_enabled"`
+	LegalHold     bool      `json:"legal_hold"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type UserSearchParams struct {
+	Query  string
+	Limit  int
+	Offset int
 }
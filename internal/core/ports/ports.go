@@ -3,6 +3,8 @@ package ports
 import (
 	"context"
 	"filesms/internal/core/domain"
+	"io"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -13,16 +15,161 @@ type UserRepository interface {
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	Update(ctx context.Context, user *domain.User) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	Search(ctx context.Context, params domain.UserSearchParams) ([]*domain.User, error)
+	ReserveStorage(ctx context.Context, id uuid.UUID, bytes, defaultQuota int64) (bool, error)
+	ReleaseStorage(ctx context.Context, id uuid.UUID, bytes int64) error
+	GetLegalHoldIDs(ctx context.Context) ([]uuid.UUID, error)
 }
 
 type FileRepository interface {
 	Create(ctx context.Context, file *domain.File) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.File, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.File, error)
+	GetBatch(ctx context.Context, afterID uuid.UUID, limit int) ([]*domain.File, error)
+	UpdateChecksum(ctx context.Context, id uuid.UUID, sha256 string) error
+	UpdateScanStatus(ctx context.Context, id uuid.UUID, status, result string, scannedAt time.Time) error
+	// SetQuarantineKey records where an infected file's blob was moved. It
+	// reports false if the file no longer exists.
+	SetQuarantineKey(ctx context.Context, id uuid.UUID, key string) (bool, error)
+	UpdateExpiration(ctx context.Context, id uuid.UUID, expiration *time.Time) error
+	TouchAccess(ctx context.Context, id uuid.UUID, accessedAt time.Time) error
+	ChangeStorageClass(ctx context.Context, id uuid.UUID, oldKey, newKey, storageClass string) (bool, error)
+	GetExpiringUnnotified(ctx context.Context, before time.Time) ([]*domain.File, error)
+	MarkExpiryNotified(ctx context.Context, fileIDs []uuid.UUID) error
+	// GetUnprocessed returns pending files uploaded before the given time
+	// that have no processing job
+	GetUnprocessed(ctx context.Context, before time.Time, limit int) ([]*domain.File, error)
 	SaveSharedFileURL(ctx context.Context, sharedFileURL *domain.SharedFileURL) error
+	GetSharedFileURL(ctx context.Context, url string) (*domain.SharedFileURL, error)
+	GetSharedFileURLsByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.SharedFileURL, error)
+	DeleteExpiredSharedFileURLs(ctx context.Context, before time.Time) (int64, error)
 	Search(ctx context.Context, userID uuid.UUID, params domain.FileSearchParams) ([]*domain.File, error)
 	GetExpiredFiles(ctx context.Context) ([]*domain.File, error)
+	CountLocked(ctx context.Context, fileIDs []uuid.UUID) (int, error)
 	DeleteFiles(ctx context.Context, fileIDs []uuid.UUID) error
+	GetUsageByUserID(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, error)
 	// Update(ctx context.Context, file *domain.File) error
 	// Delete(ctx context.Context, id uuid.UUID) error
 }
+
+type LifecyclePolicyRepository interface {
+	Create(ctx context.Context, policy *domain.LifecyclePolicy) error
+	GetAll(ctx context.Context) ([]*domain.LifecyclePolicy, error)
+	// GetApplicable returns the global policies and those of the user
+	GetApplicable(ctx context.Context, userID uuid.UUID) ([]*domain.LifecyclePolicy, error)
+	// GetByOwner returns the user's policies, or the global ones for nil
+	GetByOwner(ctx context.Context, userID *uuid.UUID) ([]*domain.LifecyclePolicy, error)
+	Delete(ctx context.Context, id uuid.UUID, userID *uuid.UUID) error
+}
+
+type RetentionRepository interface {
+	SetFileLegalHold(ctx context.Context, fileID uuid.UUID, hold bool, event *domain.RetentionEvent) error
+	SetUserLegalHold(ctx context.Context, userID uuid.UUID, hold bool, event *domain.RetentionEvent) error
+	ExtendFileRetention(ctx context.Context, fileID uuid.UUID, until time.Time, event *domain.RetentionEvent) error
+	GetEvents(ctx context.Context, fileID, userID *uuid.UUID) ([]*domain.RetentionEvent, error)
+}
+
+type JobRepository interface {
+	Create(ctx context.Context, job *domain.Job) error
+	Claim(ctx context.Context, workerID string, types []string, lockedUntil time.Time) (*domain.Job, error)
+	// Complete and Fail only apply to the attempt the job was claimed for
+	Complete(ctx context.Context, job *domain.Job) error
+	Fail(ctx context.Context, job *domain.Job, lastError string, retryAt *time.Time) error
+	Retry(ctx context.Context, id int64) error
+	GetByID(ctx context.Context, id int64) (*domain.Job, error)
+	Search(ctx context.Context, params domain.JobSearchParams) ([]*domain.Job, error)
+	DeleteSucceeded(ctx context.Context, before time.Time) (int64, error)
+}
+
+type ScheduledTaskRepository interface {
+	GetAll(ctx context.Context) ([]*domain.TaskState, error)
+	// Get returns an empty state for a task that has none stored
+	Get(ctx context.Context, name string) (*domain.TaskState, error)
+	// SetConfig stores overrides of a task's schedule and enabled flag; nil
+	// values restore the defaults
+	SetConfig(ctx context.Context, name string, schedule *string, enabled *bool) error
+	RequestRun(ctx context.Context, name string) error
+	MarkStarted(ctx context.Context, name string, startedAt time.Time) error
+	MarkFinished(ctx context.Context, name string, finishedAt time.Time, status, lastError string) error
+}
+
+type BlobDeletionRepository interface {
+	Create(ctx context.Context, deletion *domain.BlobDeletion) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*domain.BlobDeletion, error)
+	Complete(ctx context.Context, id int64) error
+	Fail(ctx context.Context, id int64, lastError string, retryAt time.Time) error
+}
+
+type ThumbnailRepository interface {
+	Save(ctx context.Context, thumbnail *domain.Thumbnail) error
+	Get(ctx context.Context, fileID uuid.UUID, size string) (*domain.Thumbnail, error)
+	GetByFileID(ctx context.Context, fileID uuid.UUID) ([]*domain.Thumbnail, error)
+	GetKeysBatch(ctx context.Context, afterKey string, limit int) ([]string, error)
+	MarkFailed(ctx context.Context, fileID uuid.UUID, reason string) error
+	HasFailed(ctx context.Context, fileID uuid.UUID) (bool, error)
+}
+
+type ShareAccessLogRepository interface {
+	Create(ctx context.Context, entry *domain.ShareAccessLog) error
+	GetBySharedFileURLID(ctx context.Context, sharedFileURLID int64, params domain.AccessLogParams) ([]*domain.ShareAccessLog, error)
+	GetByFileID(ctx context.Context, fileID uuid.UUID, params domain.AccessLogParams) ([]*domain.ShareAccessLog, error)
+	GetStatsBySharedFileURLID(ctx context.Context, sharedFileURLID int64) (*domain.ShareAccessStats, error)
+	GetStatsByFileID(ctx context.Context, fileID uuid.UUID) (*domain.ShareAccessStats, error)
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *domain.RefreshToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	Revoke(ctx context.Context, id uuid.UUID, replacedBy *uuid.UUID) (bool, error)
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *domain.Session) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error)
+	GetActiveByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error)
+	Touch(ctx context.Context, id uuid.UUID, ipAddress string, seenAt, expiresAt time.Time) error
+	Revoke(ctx context.Context, id uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *domain.APIToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*domain.APIToken, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.APIToken, error)
+	Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID) error
+}
+
+type RecoveryCodeRepository interface {
+	ReplaceForUser(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	Consume(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *domain.UserToken) error
+	Consume(ctx context.Context, purpose string, tokenHash string) (*domain.UserToken, error)
+	DeleteForUser(ctx context.Context, userID uuid.UUID, purpose string) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// Revocations reports the last time a user signed out everywhere. Credentials
+// issued to them up to then are no longer honoured.
+type Revocations interface {
+	RevokedUntil(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+type Scanner interface {
+	// Scan returns the name of the malware found in content, or "" if it is
+	// clean
+	Scan(ctx context.Context, content io.Reader) (string, error)
+}
+
+type UserIdentityRepository interface {
+	Create(ctx context.Context, identity *domain.UserIdentity) error
+	GetByIssuerSubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error)
+}
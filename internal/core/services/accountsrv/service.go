@@ -0,0 +1,159 @@
+package accountsrv
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/internal/core/services/authsrv"
+	"filesms/internal/core/services/filesrv"
+	"filesms/pkg/storage"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AccountService struct {
+	userRepo     ports.UserRepository
+	fileRepo     ports.FileRepository
+	apiTokenRepo ports.APITokenRepository
+	sessionRepo  ports.SessionRepository
+	storage      *storage.LocalStorage
+	authService  *authsrv.AuthService
+	fileService  *filesrv.FileService
+}
+
+func NewAccountService(userRepo ports.UserRepository, fileRepo ports.FileRepository, apiTokenRepo ports.APITokenRepository, sessionRepo ports.SessionRepository, storage *storage.LocalStorage, authService *authsrv.AuthService, fileService *filesrv.FileService) *AccountService {
+	return &AccountService{
+		userRepo:     userRepo,
+		fileRepo:     fileRepo,
+		apiTokenRepo: apiTokenRepo,
+		sessionRepo:  sessionRepo,
+		storage:      storage,
+		authService:  authService,
+		fileService:  fileService,
+	}
+}
+
+// GetExport collects the metadata of everything stored for the user.
+func (s *AccountService) GetExport(ctx context.Context, userID uuid.UUID) (*domain.AccountExport, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.fileRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+	sharedLinks, err := s.fileRepo.GetSharedFileURLsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared links: %w", err)
+	}
+	apiTokens, err := s.apiTokenRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api tokens: %w", err)
+	}
+	sessions, err := s.sessionRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	return &domain.AccountExport{
+		ExportedAt:  time.Now(),
+		User:        user,
+		Files:       files,
+		SharedLinks: sharedLinks,
+		APITokens:   apiTokens,
+		Sessions:    sessions,
+	}, nil
+}
+
+// WriteArchive writes the export as a zip archive: account.json with the
+// metadata and the content of every file under files/<id>/.
+func (s *AccountService) WriteArchive(export *domain.AccountExport, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	entry, err := archive.Create("account.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	for _, file := range export.Files {
+		if err := s.addFile(archive, file); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (s *AccountService) addFile(archive *zip.Writer, file *domain.File) error {
+	if file.ScanStatus != domain.ScanStatusClean {
+		log.Printf("Skipping file %s in export, its scan status is %s", file.ID, file.ScanStatus)
+		return nil
+	}
+	path, err := s.storage.Get(file.URL)
+	if err != nil {
+		log.Printf("Skipping missing blob of file %s in export: %v", file.ID, err)
+		return nil
+	}
+	content, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", file.ID, err)
+	}
+	defer content.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     fmt.Sprintf("files/%s/%s", file.ID, filepath.Base(file.Name)),
+		Method:   zip.Deflate,
+		Modified: file.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+// DeleteAccount permanently removes the user after reauthentication: file
+// content, share links, sessions and every row referencing the account.
+func (s *AccountService) DeleteAccount(ctx context.Context, userID uuid.UUID, password, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.Reauthenticate(ctx, user, password, code); err != nil {
+		return err
+	}
+	// Held accounts are kept with all their content until the hold is released
+	if user.LegalHold {
+		return filesrv.ErrFileLocked
+	}
+
+	files, err := s.fileRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get files: %w", err)
+	}
+	if err := s.fileService.DeleteFiles(ctx, files); err != nil {
+		return err
+	}
+	// Revoke first so tokens already issued stop working once the user is gone
+	if err := s.authService.LogoutAll(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	log.Printf("User %s deleted their account and %d files", userID, len(files))
+	return nil
+}
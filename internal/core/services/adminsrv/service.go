@@ -0,0 +1,161 @@
+package adminsrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/internal/core/services/authsrv"
+	"filesms/internal/core/services/filesrv"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrSelfModification = errors.New("admins cannot disable themselves")
+
+type AdminService struct {
+	userRepo    ports.UserRepository
+	fileRepo    ports.FileRepository
+	authService *authsrv.AuthService
+	fileService *filesrv.FileService
+}
+
+func NewAdminService(userRepo ports.UserRepository, fileRepo ports.FileRepository, authService *authsrv.AuthService, fileService *filesrv.FileService) *AdminService {
+	return &AdminService{
+		userRepo:    userRepo,
+		fileRepo:    fileRepo,
+		authService: authService,
+		fileService: fileService,
+	}
+}
+
+func (s *AdminService) SearchUsers(ctx context.Context, params domain.UserSearchParams) ([]*domain.User, error) {
+	return s.userRepo.Search(ctx, params)
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling also signs the
+// user out of every session.
+func (s *AdminService) SetUserDisabled(ctx context.Context, adminID, userID uuid.UUID, disabled bool) (*domain.User, error) {
+	if adminID == userID && disabled {
+		return nil, ErrSelfModification
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Disabled = disabled
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if disabled {
+		if err := s.authService.LogoutAll(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+	log.Printf("Admin %s set disabled=%t for user %s", adminID, disabled, user.ID)
+	return user, nil
+}
+
+// ResetUserPassword sets the given password, or emails the user a reset link
+// when password is empty. Either way existing sessions are revoked.
+func (s *AdminService) ResetUserPassword(ctx context.Context, adminID, userID uuid.UUID, password string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if password == "" {
+		if err := s.authService.RequestPasswordReset(ctx, user.Email); err != nil {
+			return err
+		}
+	} else {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.Password = string(hashedPassword)
+		user.UpdatedAt = time.Now()
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	if err := s.authService.LogoutAll(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	log.Printf("Admin %s reset the password of user %s", adminID, user.ID)
+	return nil
+}
+
+// UnlockUser lifts a login lockout of the user.
+func (s *AdminService) UnlockUser(ctx context.Context, adminID, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	s.authService.UnlockAccount(ctx, user.Email)
+	log.Printf("Admin %s unlocked user %s", adminID, user.ID)
+	return nil
+}
+
+func (s *AdminService) GetUserFiles(ctx context.Context, userID uuid.UUID) ([]*domain.File, error) {
+	return s.fileRepo.GetByUserID(ctx, userID)
+}
+
+func (s *AdminService) GetUserUsage(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, error) {
+	return s.fileService.GetUsage(ctx, userID)
+}
+
+// SetUserQuota overrides the storage quota of the user; nil restores the default.
+func (s *AdminService) SetUserQuota(ctx context.Context, adminID, userID uuid.UUID, quota *int64) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.StorageQuota = quota
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	log.Printf("Admin %s set the storage quota of user %s to %v", adminID, user.ID, formatQuota(quota))
+	return user, nil
+}
+
+func (s *AdminService) DeleteFile(ctx context.Context, adminID, fileID uuid.UUID) error {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if err := s.fileService.DeleteFiles(ctx, []*domain.File{file}); err != nil {
+		return err
+	}
+	log.Printf("Admin %s force-deleted file %s of user %s", adminID, file.ID, file.UserID)
+	return nil
+}
+
+// DeleteUserFiles removes all content of a user and returns how many files were deleted.
+func (s *AdminService) DeleteUserFiles(ctx context.Context, adminID, userID uuid.UUID) (int, error) {
+	files, err := s.fileRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.fileService.DeleteFiles(ctx, files); err != nil {
+		return 0, err
+	}
+	log.Printf("Admin %s force-deleted %d files of user %s", adminID, len(files), userID)
+	return len(files), nil
+}
+
+func formatQuota(quota *int64) string {
+	if quota == nil {
+		return "the default"
+	}
+	return fmt.Sprintf("%d bytes", *quota)
+}
@@ -0,0 +1,113 @@
+package apitokensrv
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidScope    = errors.New("invalid scope")
+	ErrInvalidAPIToken = errors.New("invalid api token")
+)
+
+type APITokenService struct {
+	tokenRepo ports.APITokenRepository
+	userRepo  ports.UserRepository
+}
+
+func NewAPITokenService(tokenRepo ports.APITokenRepository, userRepo ports.UserRepository) *APITokenService {
+	return &APITokenService{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// Create issues a new API token. The plaintext token is only returned here;
+// just its SHA-256 hash is stored.
+func (s *APITokenService) Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresIn time.Duration) (*domain.NewAPIToken, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(domain.APITokenScopes, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	plaintext := domain.APITokenPrefix + hex.EncodeToString(raw)
+
+	token := &domain.APIToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plaintext[:len(domain.APITokenPrefix)+8],
+		TokenHash: hashToken(plaintext),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt: time.Now(),
+	}
+	if expiresIn > 0 {
+		expiresAt := token.CreatedAt.Add(expiresIn)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, fmt.Errorf("failed to save api token: %w", err)
+	}
+	return &domain.NewAPIToken{APIToken: token, Token: plaintext}, nil
+}
+
+func (s *APITokenService) List(ctx context.Context, userID uuid.UUID) ([]*domain.APIToken, error) {
+	return s.tokenRepo.GetByUserID(ctx, userID)
+}
+
+func (s *APITokenService) Revoke(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error {
+	return s.tokenRepo.Revoke(ctx, tokenID, userID)
+}
+
+// VerifyAPIToken resolves a plaintext API token to its owner and scopes.
+func (s *APITokenService) VerifyAPIToken(ctx context.Context, plaintext string) (uuid.UUID, []string, error) {
+	if !strings.HasPrefix(plaintext, domain.APITokenPrefix) {
+		return uuid.Nil, nil, ErrInvalidAPIToken
+	}
+
+	token, err := s.tokenRepo.GetByHash(ctx, hashToken(plaintext))
+	if err != nil {
+		return uuid.Nil, nil, ErrInvalidAPIToken
+	}
+	if token.RevokedAt != nil {
+		return uuid.Nil, nil, ErrInvalidAPIToken
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return uuid.Nil, nil, ErrInvalidAPIToken
+	}
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil || user.Disabled {
+		return uuid.Nil, nil, ErrInvalidAPIToken
+	}
+
+	if err := s.tokenRepo.TouchLastUsed(ctx, token.ID); err != nil {
+		log.Printf("Error updating api token last use: %v", err)
+	}
+	return token.UserID, token.Scopes, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package authsrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const emailChangeDuration = 24 * time.Hour
+
+var (
+	ErrReauthenticationFailed = errors.New("reauthentication failed")
+	ErrEmailInUse             = errors.New("email already in use")
+)
+
+// Reauthenticate confirms a sensitive action with the user's password and,
+// when two-factor authentication is enabled, a TOTP or recovery code.
+func (s *AuthService) Reauthenticate(ctx context.Context, user *domain.User, password, code string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrReauthenticationFailed
+	}
+	if user.TOTPEnabled && !s.verifySecondFactor(ctx, user, code) {
+		return ErrReauthenticationFailed
+	}
+	return nil
+}
+
+// ChangePassword sets a new password and signs out every other session.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, currentPassword, code, newPassword string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.Reauthenticate(ctx, user, currentPassword, code); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashedPassword)
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	sessions, err := s.sessionRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			continue
+		}
+		if err := s.RevokeSession(ctx, userID, session.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.mailer.Send(ctx, user.Email, "Your password was changed",
+		"The password of your filesms account was just changed. If this was not you, reset your password immediately."); err != nil {
+		log.Printf("Error sending password change notice to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// RequestEmailChange sends a confirmation link to the new address. The email
+// is only changed once that link is used.
+func (s *AuthService) RequestEmailChange(ctx context.Context, userID uuid.UUID, password, code, newEmail string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.Reauthenticate(ctx, user, password, code); err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetByEmail(ctx, newEmail); err == nil {
+		return ErrEmailInUse
+	}
+
+	token, err := s.issueUserTokenForEmail(ctx, user.ID, domain.UserTokenEmailChange, newEmail, emailChangeDuration)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Confirm the new email address of your filesms account using this link:\n%s/account/email/confirm?token=%s", s.appURL, token)
+	if err := s.mailer.Send(ctx, newEmail, "Confirm your new email address", body); err != nil {
+		return fmt.Errorf("failed to send confirmation email: %w", err)
+	}
+
+	notice := fmt.Sprintf("A change of your account email to %s was requested. If this was not you, change your password.", newEmail)
+	if err := s.mailer.Send(ctx, user.Email, "Email change requested", notice); err != nil {
+		log.Printf("Error sending email change notice to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) error {
+	userToken, err := s.userTokenRepo.Consume(ctx, domain.UserTokenEmailChange, hashToken(token))
+	if err != nil || userToken.Email == "" {
+		return ErrInvalidUserToken
+	}
+	// The address may have been registered since the change was requested
+	if _, err := s.userRepo.GetByEmail(ctx, userToken.Email); err == nil {
+		return ErrEmailInUse
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return err
+	}
+	oldEmail := user.Email
+	user.Email = userToken.Email
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	log.Printf("User %s changed email from %s to %s", user.ID, oldEmail, user.Email)
+	return nil
+}
@@ -0,0 +1,149 @@
+package authsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"filesms/internal/core/domain"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailVerificationDuration = 48 * time.Hour
+	passwordResetDuration     = time.Hour
+)
+
+var (
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrInvalidUserToken     = errors.New("invalid or expired token")
+)
+
+// ResendVerificationEmail sends a new verification link, invalidating earlier ones.
+func (s *AuthService) ResendVerificationEmail(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerificationEmail(ctx, user)
+}
+
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	userToken, err := s.userTokenRepo.Consume(ctx, domain.UserTokenEmailVerification, hashToken(token))
+	if err != nil {
+		return ErrInvalidUserToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return err
+	}
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+	return s.userRepo.Update(ctx, user)
+}
+
+// RequestPasswordReset emails a reset link if the account exists. It never
+// reports whether the email is registered.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	token, err := s.issueUserToken(ctx, user.ID, domain.UserTokenPasswordReset, passwordResetDuration)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("A password reset was requested for your account.\n\n"+
+		"Reset your password within the next hour using this link:\n%s/password/reset?token=%s\n\n"+
+		"If you did not request this, you can ignore this email.", s.appURL, token)
+	if err := s.mailer.Send(ctx, user.Email, "Reset your password", body); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	userToken, err := s.userTokenRepo.Consume(ctx, domain.UserTokenPasswordReset, hashToken(token))
+	if err != nil {
+		return ErrInvalidUserToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashedPassword)
+	// Receiving the reset link proves ownership of the address
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	if err := s.userTokenRepo.DeleteForUser(ctx, user.ID, domain.UserTokenPasswordReset); err != nil {
+		log.Printf("Error deleting password reset tokens for user %s: %v", user.ID, err)
+	}
+	s.clearLoginFailures(ctx, user.Email)
+	return s.LogoutAll(ctx, user.ID)
+}
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	token, err := s.issueUserToken(ctx, user.ID, domain.UserTokenEmailVerification, emailVerificationDuration)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Welcome to filesms!\n\nPlease verify your email address using this link:\n%s/verify-email?token=%s", s.appURL, token)
+	return s.mailer.Send(ctx, user.Email, "Verify your email address", body)
+}
+
+// issueUserToken replaces any outstanding token of the same purpose with a new one.
+func (s *AuthService) issueUserToken(ctx context.Context, userID uuid.UUID, purpose string, duration time.Duration) (string, error) {
+	return s.issueUserTokenForEmail(ctx, userID, purpose, "", duration)
+}
+
+// issueUserTokenForEmail issues a token bound to an address other than the
+// user's current one, such as the target of an email change.
+func (s *AuthService) issueUserTokenForEmail(ctx context.Context, userID uuid.UUID, purpose, email string, duration time.Duration) (string, error) {
+	if err := s.userTokenRepo.DeleteForUser(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	now := time.Now()
+	userToken := &domain.UserToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	}
+	if err := s.userTokenRepo.Create(ctx, userToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,195 @@
+package authsrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/pkg/cache/redis"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	failedLoginWindow = time.Hour
+
+	// Failures before each further attempt on the account is delayed
+	loginDelayThreshold = 3
+	maxLoginDelay       = time.Minute
+
+	accountLockThreshold = 10
+	accountLockDuration  = 30 * time.Minute
+
+	ipLockThreshold = 50
+	ipLockDuration  = time.Hour
+
+	accountUnlockDuration = 24 * time.Hour
+)
+
+var (
+	ErrAccountLocked      = errors.New("account temporarily locked")
+	ErrTooManyAttempts    = errors.New("too many login attempts")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// LoginBlockedError is returned while a login is throttled or locked out.
+type LoginBlockedError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", e.Err, e.RetryAfter)
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Err
+}
+
+// checkLoginAllowed refuses attempts while the IP or account is locked or the
+// account is still inside its progressive delay.
+func (s *AuthService) checkLoginAllowed(ctx context.Context, email, ip string) error {
+	checks := []struct {
+		key string
+		err error
+	}{
+		{ipLockKey(ip), ErrTooManyAttempts},
+		{accountLockKey(email), ErrAccountLocked},
+		{loginDelayKey(email), ErrTooManyAttempts},
+	}
+	for _, check := range checks {
+		ttl, err := s.cache.TTL(ctx, check.key)
+		if err == redis.ErrCacheMiss {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return &LoginBlockedError{Err: check.err, RetryAfter: ttl}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt against the account and the IP,
+// applying delays and lockouts once the thresholds are reached. Unknown emails
+// are counted too so lockouts do not reveal which accounts exist.
+func (s *AuthService) recordLoginFailure(ctx context.Context, email, ip string) {
+	failures, err := s.cache.Incr(ctx, accountFailuresKey(email), failedLoginWindow)
+	if err != nil {
+		log.Printf("Error recording failed login for %s: %v", email, err)
+		return
+	}
+
+	switch {
+	case failures >= accountLockThreshold:
+		locked, err := s.cache.SetNX(ctx, accountLockKey(email), true, accountLockDuration)
+		if err != nil {
+			log.Printf("Error locking account %s: %v", email, err)
+		} else if locked {
+			log.Printf("Account %s locked after %d failed login attempts (last from %s)", email, failures, ip)
+			s.cache.Delete(ctx, accountFailuresKey(email))
+			s.sendUnlockEmail(ctx, email)
+		}
+	case failures >= loginDelayThreshold:
+		delay := time.Second << (failures - loginDelayThreshold)
+		if delay > maxLoginDelay {
+			delay = maxLoginDelay
+		}
+		if err := s.cache.Set(ctx, loginDelayKey(email), true, delay); err != nil {
+			log.Printf("Error delaying logins for %s: %v", email, err)
+		}
+	}
+
+	if ip == "" {
+		return
+	}
+	ipFailures, err := s.cache.Incr(ctx, ipFailuresKey(ip), failedLoginWindow)
+	if err != nil {
+		log.Printf("Error recording failed login from %s: %v", ip, err)
+		return
+	}
+	if ipFailures >= ipLockThreshold {
+		locked, err := s.cache.SetNX(ctx, ipLockKey(ip), true, ipLockDuration)
+		if err != nil {
+			log.Printf("Error blocking IP %s: %v", ip, err)
+		} else if locked {
+			log.Printf("IP %s blocked after %d failed login attempts", ip, ipFailures)
+			s.cache.Delete(ctx, ipFailuresKey(ip))
+		}
+	}
+}
+
+func (s *AuthService) clearLoginFailures(ctx context.Context, email string) {
+	for _, key := range []string{accountFailuresKey(email), loginDelayKey(email), accountLockKey(email)} {
+		if err := s.cache.Delete(ctx, key); err != nil {
+			log.Printf("Error clearing login failures for %s: %v", email, err)
+		}
+	}
+}
+
+// UnlockAccount lifts a lockout of the account with the given email.
+func (s *AuthService) UnlockAccount(ctx context.Context, email string) {
+	s.clearLoginFailures(ctx, email)
+	log.Printf("Account %s unlocked", email)
+}
+
+// UnlockAccountWithToken lifts a lockout using the link emailed when the
+// account was locked.
+func (s *AuthService) UnlockAccountWithToken(ctx context.Context, token string) error {
+	userToken, err := s.userTokenRepo.Consume(ctx, domain.UserTokenAccountUnlock, hashToken(token))
+	if err != nil {
+		return ErrInvalidUserToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return err
+	}
+	s.UnlockAccount(ctx, user.Email)
+	return nil
+}
+
+func (s *AuthService) sendUnlockEmail(ctx context.Context, email string) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return
+	}
+
+	token, err := s.issueUserToken(ctx, user.ID, domain.UserTokenAccountUnlock, accountUnlockDuration)
+	if err != nil {
+		log.Printf("Error issuing unlock token for user %s: %v", user.ID, err)
+		return
+	}
+
+	body := fmt.Sprintf("Your account was temporarily locked after too many failed sign-in attempts.\n\n"+
+		"If this was you, unlock it now using this link:\n%s/account/unlock?token=%s\n\n"+
+		"If it was not you, consider changing your password.", s.appURL, token)
+	if err := s.mailer.Send(ctx, user.Email, "Your account has been locked", body); err != nil {
+		log.Printf("Error sending unlock email to %s: %v", user.Email, err)
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func accountFailuresKey(email string) string {
+	return fmt.Sprintf("login_failures:account:%s", normalizeEmail(email))
+}
+
+func accountLockKey(email string) string {
+	return fmt.Sprintf("login_lock:account:%s", normalizeEmail(email))
+}
+
+func loginDelayKey(email string) string {
+	return fmt.Sprintf("login_delay:account:%s", normalizeEmail(email))
+}
+
+func ipFailuresKey(ip string) string {
+	return fmt.Sprintf("login_failures:ip:%s", ip)
+}
+
+func ipLockKey(ip string) string {
+	return fmt.Sprintf("login_lock:ip:%s", ip)
+}
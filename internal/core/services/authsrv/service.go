@@ -2,26 +2,59 @@ package authsrv
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"filesms/internal/core/domain"
 	"filesms/internal/core/ports"
+	"fmt"
+	"log"
 	"time"
 
+	"filesms/pkg/cache/redis"
 	"filesms/pkg/jwt"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	accessTokenDuration  = 15 * time.Minute
+	refreshTokenDuration = 30 * 24 * time.Hour
+	// A logout-all is remembered this long, which covers access tokens and
+	// presigned upload URLs alike
+	revocationDuration = 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrAccountDisabled     = errors.New("account disabled")
+)
+
 type AuthService struct {
-	userRepo ports.UserRepository
-	jwtMaker jwt.Maker
+	userRepo         ports.UserRepository
+	refreshTokenRepo ports.RefreshTokenRepository
+	sessionRepo      ports.SessionRepository
+	recoveryCodeRepo ports.RecoveryCodeRepository
+	userTokenRepo    ports.UserTokenRepository
+	jwtMaker         jwt.Maker
+	cache            *redis.RedisCache
+	mailer           ports.Mailer
+	appURL           string
 }
 
-func NewAuthService(userRepo ports.UserRepository, jwtMaker jwt.Maker) *AuthService {
+func NewAuthService(userRepo ports.UserRepository, refreshTokenRepo ports.RefreshTokenRepository, sessionRepo ports.SessionRepository, recoveryCodeRepo ports.RecoveryCodeRepository, userTokenRepo ports.UserTokenRepository, jwtMaker jwt.Maker, cache *redis.RedisCache, mailer ports.Mailer, appURL string) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		jwtMaker: jwtMaker,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		sessionRepo:      sessionRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		userTokenRepo:    userTokenRepo,
+		jwtMaker:         jwtMaker,
+		cache:            cache,
+		mailer:           mailer,
+		appURL:           appURL,
 	}
 }
 func (s *AuthService) Register(ctx context.Context, email, password string) (*domain.User, error) {
@@ -41,25 +74,279 @@ func (s *AuthService) Register(ctx context.Context, email, password string) (*do
 		return nil, err
 	}
 
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Error sending verification email to %s: %v", user.Email, err)
+	}
+
 	return user, nil
 }
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
+
+// Login checks the password. Accounts with two-factor authentication get a
+// challenge token to complete with CompleteLogin instead of tokens. Repeated
+// failures from the account or IP are throttled and eventually locked out;
+// they are only cleared once the whole login succeeds.
+func (s *AuthService) Login(ctx context.Context, email, password string, client domain.ClientInfo) (*domain.LoginResult, error) {
+	if err := s.checkLoginAllowed(ctx, email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		s.recordLoginFailure(ctx, email, client.IPAddress)
+		return nil, ErrInvalidCredentials
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+		s.recordLoginFailure(ctx, email, client.IPAddress)
+		return nil, ErrInvalidCredentials
 	}
 
-	token, err := s.jwtMaker.CreateToken(user.ID, time.Hour*24)
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := s.createLoginChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	s.clearLoginFailures(ctx, email)
+	tokens, err := s.startSession(ctx, user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{TokenPair: tokens}, nil
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and a new
+// pair is issued. Presenting an already rotated token is treated as theft and
+// revokes every session of the user.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (*domain.TokenPair, error) {
+	token, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(refreshToken))
 	if err != nil {
-		return "", err
+		return nil, ErrInvalidRefreshToken
 	}
 
-	return token, nil
+	if token.RevokedAt != nil {
+		// Tokens revoked by logging out were never rotated and are not a sign of theft
+		if token.ReplacedBy == nil {
+			return nil, ErrInvalidRefreshToken
+		}
+		log.Printf("Refresh token reuse detected for user %s, revoking all sessions", token.UserID)
+		if err := s.LogoutAll(ctx, token.UserID); err != nil {
+			log.Printf("Error revoking sessions for user %s: %v", token.UserID, err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newID := uuid.New()
+	revoked, err := s.refreshTokenRepo.Revoke(ctx, token.ID, &newID)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		// Lost a race against another rotation of the same token
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Refresh tokens from before sessions existed start a new session
+	if token.SessionID == nil {
+		return s.startSession(ctx, token.UserID, client)
+	}
+	now := time.Now()
+	if err := s.sessionRepo.Touch(ctx, *token.SessionID, client.IPAddress, now, now.Add(refreshTokenDuration)); err != nil {
+		log.Printf("Error updating session %s: %v", *token.SessionID, err)
+	}
+	return s.issueTokens(ctx, token.UserID, *token.SessionID, newID)
+}
+
+// Logout ends the current session, revoking the access token identified by
+// tokenID and, if given, the refresh token belonging to the same user.
+func (s *AuthService) Logout(ctx context.Context, userID, sessionID uuid.UUID, tokenID string, tokenExpiresAt time.Time, refreshToken string) error {
+	if err := s.revokeAccessToken(ctx, tokenID, tokenExpiresAt); err != nil {
+		return err
+	}
+	if err := s.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	token, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil || token.UserID != userID {
+		return nil
+	}
+	_, err = s.refreshTokenRepo.Revoke(ctx, token.ID, nil)
+	return err
+}
+
+// LogoutAll revokes every refresh token of the user and every access token
+// and presigned upload URL issued to them up to now.
+func (s *AuthService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	if err := s.sessionRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	// Access tokens and upload URLs issued up to this second are rejected
+	// until they would have expired anyway. Token timestamps are whole seconds, so one issued
+	// in the same second may predate the logout and is rejected too
+	if err := s.cache.Set(ctx, revokedUserKey(userID), time.Now().Unix(), revocationDuration); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether an access token was revoked by Logout,
+// LogoutAll or the revocation of its session.
+func (s *AuthService) IsTokenRevoked(ctx context.Context, tokenID string, userID, sessionID uuid.UUID, issuedAt time.Time) (bool, error) {
+	revoked, err := s.cache.Exists(ctx, revokedTokenKey(tokenID))
+	if err != nil || revoked {
+		return revoked, err
+	}
+	revoked, err = s.cache.Exists(ctx, revokedSessionKey(sessionID))
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	cutoff, err := s.RevokedUntil(ctx, userID)
+	if err != nil || cutoff.IsZero() {
+		return false, err
+	}
+	return !issuedAt.After(cutoff), nil
 }
+
+// RevokedUntil returns when the user last signed out everywhere, or the zero
+// time if they have not recently. It has one-second precision.
+func (s *AuthService) RevokedUntil(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	var cutoff int64
+	err := s.cache.Get(ctx, revokedUserKey(userID), &cutoff)
+	if errors.Is(err, redis.ErrCacheMiss) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(cutoff, 0), nil
+}
+
+// SignIn signs in a user who was authenticated by other means, such as an
+// external identity provider. Like Login, accounts with two-factor
+// authentication get a challenge to complete with CompleteLogin.
+func (s *AuthService) SignIn(ctx context.Context, userID uuid.UUID, client domain.ClientInfo) (*domain.LoginResult, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := s.createLoginChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := s.startSession(ctx, user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{TokenPair: tokens}, nil
+}
+
+// JWKS returns the public keys access tokens can be verified with. It is
+// empty when tokens are signed with a shared secret.
+func (s *AuthService) JWKS() jwt.JWKSet {
+	if keySet, ok := s.jwtMaker.(jwt.KeySet); ok {
+		return keySet.JWKS()
+	}
+	return jwt.JWKSet{Keys: []jwt.JWK{}}
+}
+
 func (s *AuthService) Me(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
 	return s.userRepo.GetByID(ctx, userID)
 }
+
+// IsAdmin reports whether the user has the admin role and is not disabled.
+func (s *AuthService) IsAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == domain.RoleAdmin && !user.Disabled, nil
+}
+
+// issueTokens is the single place tokens are minted, so disabled accounts
+// are refused here for every sign-in path.
+func (s *AuthService) issueTokens(ctx context.Context, userID, sessionID, refreshTokenID uuid.UUID) (*domain.TokenPair, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	now := time.Now()
+	accessToken, err := s.jwtMaker.CreateToken(userID, sessionID, accessTokenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refreshToken := hex.EncodeToString(raw)
+
+	token := &domain.RefreshToken{
+		ID:        refreshTokenID,
+		UserID:    userID,
+		SessionID: &sessionID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(refreshTokenDuration),
+		CreatedAt: now,
+	}
+	if err := s.refreshTokenRepo.Create(ctx, token); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return &domain.TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  now.Add(accessTokenDuration),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: token.ExpiresAt,
+	}, nil
+}
+
+func (s *AuthService) revokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.cache.Set(ctx, revokedTokenKey(tokenID), true, ttl)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func revokedTokenKey(tokenID string) string {
+	return fmt.Sprintf("revoked_token:%s", tokenID)
+}
+
+func revokedUserKey(userID uuid.UUID) string {
+	return fmt.Sprintf("revoked_user:%s", userID)
+}
@@ -0,0 +1,86 @@
+package authsrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sessionTouchInterval limits how often request activity is written to the
+// database for a single session.
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions returns the active sessions of the user, marking the one the
+// request was made with.
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]*domain.Session, error) {
+	sessions, err := s.sessionRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the session out: its refresh tokens stop working at once
+// and access tokens minted for it are rejected by the middleware.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	if err := s.sessionRepo.Revoke(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if err := s.cache.Set(ctx, revokedSessionKey(session.ID), true, accessTokenDuration); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+// TouchSession records that the session was used. Writes are throttled per
+// session and failures only logged, as this runs on every request.
+func (s *AuthService) TouchSession(ctx context.Context, sessionID uuid.UUID, ipAddress string) {
+	first, err := s.cache.SetNX(ctx, sessionTouchKey(sessionID), true, sessionTouchInterval)
+	if err != nil || !first {
+		return
+	}
+	if err := s.sessionRepo.Touch(ctx, sessionID, ipAddress, time.Now(), time.Time{}); err != nil {
+		log.Printf("Error updating session %s: %v", sessionID, err)
+	}
+}
+
+// startSession records a new sign-in and issues its first token pair.
+func (s *AuthService) startSession(ctx context.Context, userID uuid.UUID, client domain.ClientInfo) (*domain.TokenPair, error) {
+	now := time.Now()
+	session := &domain.Session{
+		ID:         uuid.New(),
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		ExpiresAt:  now.Add(refreshTokenDuration),
+		LastSeenAt: now,
+		CreatedAt:  now,
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+	return s.issueTokens(ctx, userID, session.ID, uuid.New())
+}
+
+func revokedSessionKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("revoked_session:%s", sessionID)
+}
+
+func sessionTouchKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("session_seen:%s", sessionID)
+}
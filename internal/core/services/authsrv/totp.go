@@ -0,0 +1,234 @@
+package authsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"filesms/internal/core/domain"
+	"fmt"
+	"strings"
+	"time"
+
+	"filesms/pkg/totp"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer             = "filesms"
+	loginChallengeDuration = 5 * time.Minute
+	maxChallengeAttempts   = 5
+	recoveryCodeCount      = 10
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication not enrolled")
+	ErrInvalidTOTPCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge   = errors.New("invalid or expired login challenge")
+)
+
+// EnrollTOTP creates a new secret for the user. It only takes effect once
+// confirmed with a code from the authenticator app via ConfirmTOTP.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	user.TOTPSecret = secret
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication and returns a fresh set of
+// recovery codes, shown to the user only this once.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if !s.validateTOTP(ctx, user, code) {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, err := s.regenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off after re-checking the
+// password and a current code.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID uuid.UUID, password, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return errors.New("invalid credentials")
+	}
+	if !s.verifySecondFactor(ctx, user, code) {
+		return ErrInvalidTOTPCode
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	return s.recoveryCodeRepo.DeleteForUser(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes invalidates the existing recovery codes after
+// checking a current code.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if !s.validateTOTP(ctx, user, code) {
+		return nil, ErrInvalidTOTPCode
+	}
+	return s.regenerateRecoveryCodes(ctx, user.ID)
+}
+
+// CompleteLogin exchanges a login challenge and a TOTP or recovery code for
+// tokens. Wrong codes count towards the same lockouts as wrong passwords, so
+// starting fresh challenges does not allow guessing codes indefinitely.
+func (s *AuthService) CompleteLogin(ctx context.Context, challengeToken, code string, client domain.ClientInfo) (*domain.TokenPair, error) {
+	key := loginChallengeKey(challengeToken)
+	var userID uuid.UUID
+	if err := s.cache.Get(ctx, key, &userID); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	attempts, err := s.cache.Incr(ctx, key+":attempts", loginChallengeDuration)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > maxChallengeAttempts {
+		s.cache.Delete(ctx, key)
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if err := s.checkLoginAllowed(ctx, user.Email, client.IPAddress); err != nil {
+		return nil, err
+	}
+	if !s.verifySecondFactor(ctx, user, code) {
+		s.recordLoginFailure(ctx, user.Email, client.IPAddress)
+		return nil, ErrInvalidTOTPCode
+	}
+
+	if err := s.cache.Delete(ctx, key); err != nil {
+		return nil, err
+	}
+	s.clearLoginFailures(ctx, user.Email)
+	return s.startSession(ctx, user.ID, client)
+}
+
+func (s *AuthService) createLoginChallenge(ctx context.Context, userID uuid.UUID) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	challenge := fmt.Sprintf("%x", raw)
+	if err := s.cache.Set(ctx, loginChallengeKey(challenge), userID, loginChallengeDuration); err != nil {
+		return "", fmt.Errorf("failed to save challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *domain.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.validateTOTP(ctx, user, code)
+	}
+
+	ok, err := s.recoveryCodeRepo.Consume(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false
+	}
+	return ok
+}
+
+// validateTOTP checks the code and rejects a code that was already used, so
+// an observed code cannot be replayed within its validity window.
+func (s *AuthService) validateTOTP(ctx context.Context, user *domain.User, code string) bool {
+	if !totp.Validate(user.TOTPSecret, code, time.Now()) {
+		return false
+	}
+	key := fmt.Sprintf("totp_used:%s:%s", user.ID, code)
+	fresh, err := s.cache.SetNX(ctx, key, true, totp.Period*(2*totp.Skew+1))
+	return err == nil && fresh
+}
+
+func (s *AuthService) regenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(code)
+	}
+
+	if err := s.recoveryCodeRepo.ReplaceForUser(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func loginChallengeKey(challenge string) string {
+	return fmt.Sprintf("login_challenge:%s", hashToken(challenge))
+}
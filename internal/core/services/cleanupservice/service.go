@@ -2,72 +2,111 @@ package cleanupservice
 
 import (
 	"context"
+	"errors"
 	"filesms/internal/core/ports"
+	"filesms/pkg/storage"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	deletionBatchSize = 100
+	// A claimed deletion is retried by another worker if not finished by then
+	deletionLease      = 5 * time.Minute
+	maxDeletionBackoff = time.Hour
+	// Expired share links are kept this long so their access logs stay
+	// linked to them
+	shareRetention = 30 * 24 * time.Hour
+)
+
+// CleanupService holds the maintenance tasks run by the scheduler.
 type CleanupService struct {
-	fileRepo      ports.FileRepository
-	storageDir    string
-	checkInterval time.Duration
+	fileRepo  ports.FileRepository
+	deletions ports.BlobDeletionRepository
+	storage   *storage.LocalStorage
 }
 
-func NewCleanupService(fileRepo ports.FileRepository, storageDir string, checkInterval time.Duration) *CleanupService {
+func NewCleanupService(fileRepo ports.FileRepository, deletions ports.BlobDeletionRepository, storage *storage.LocalStorage) *CleanupService {
 	return &CleanupService{
-		fileRepo:      fileRepo,
-		storageDir:    storageDir,
-		checkInterval: checkInterval,
-	}
-}
-
-func (s *CleanupService) Start(ctx context.Context) {
-	fmt.Println("Starting cleanup service...")
-	ticker := time.NewTicker(s.checkInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			s.cleanupExpiredFiles(ctx)
-		}
+		fileRepo:  fileRepo,
+		deletions: deletions,
+		storage:   storage,
 	}
 }
 
-func (s *CleanupService) cleanupExpiredFiles(ctx context.Context) {
-	// fmt.Println("Checking for expired files...(every 10 seconds)")
+func (s *CleanupService) DeleteExpiredFiles(ctx context.Context) error {
 	expiredFiles, err := s.fileRepo.GetExpiredFiles(ctx)
 	if err != nil {
-		log.Printf("Error getting expired files: %v", err)
-		return
+		return fmt.Errorf("failed to get expired files: %w", err)
 	}
 
 	var filesToDelete []uuid.UUID
 	for _, file := range expiredFiles {
-		fmt.Println("Deleting expired file:", file.URL)
-		// Delete file from local storage
-		err := os.Remove(filepath.Join(s.storageDir, file.URL))
-		if err != nil {
-			log.Printf("Error deleting file %s: %v", file.URL, err)
-			continue
-		}
 		filesToDelete = append(filesToDelete, file.ID)
 	}
 
-	// Delete files from database
+	// Delete files from database; their blobs are queued for removal
 	if len(filesToDelete) > 0 {
-		err := s.fileRepo.DeleteFiles(ctx, filesToDelete)
+		if err := s.fileRepo.DeleteFiles(ctx, filesToDelete); err != nil {
+			return fmt.Errorf("failed to delete files from database: %w", err)
+		}
+		log.Printf("Successfully deleted %d expired files", len(filesToDelete))
+	}
+	return nil
+}
+
+// DeleteExpiredShares removes share links that expired a while ago.
+func (s *CleanupService) DeleteExpiredShares(ctx context.Context) error {
+	deleted, err := s.fileRepo.DeleteExpiredSharedFileURLs(ctx, time.Now().Add(-shareRetention))
+	if err != nil {
+		return fmt.Errorf("failed to delete expired share links: %w", err)
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired share links", deleted)
+	}
+	return nil
+}
+
+// ProcessBlobDeletions drains the deletion outbox. Removing a blob that is
+// already gone counts as success, so entries can be retried safely.
+func (s *CleanupService) ProcessBlobDeletions(ctx context.Context) error {
+	for {
+		deletions, err := s.deletions.ClaimDue(ctx, deletionBatchSize, deletionLease)
 		if err != nil {
-			log.Printf("Error deleting files from database: %v", err)
-		} else {
-			log.Printf("Successfully deleted %d expired files", len(filesToDelete))
+			return fmt.Errorf("failed to claim blob deletions: %w", err)
 		}
+
+		for _, deletion := range deletions {
+			// A row committed for the key means the blob is live again
+			if !deletion.Referenced {
+				if err := s.storage.Delete(deletion.StorageKey); err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.Printf("Error deleting blob %s (attempt %d): %v", deletion.StorageKey, deletion.Attempts, err)
+					if err := s.deletions.Fail(ctx, deletion.ID, err.Error(), time.Now().Add(deletionBackoff(deletion.Attempts))); err != nil {
+						log.Printf("Error rescheduling blob deletion %d: %v", deletion.ID, err)
+					}
+					continue
+				}
+			}
+			if err := s.deletions.Complete(ctx, deletion.ID); err != nil {
+				log.Printf("Error completing blob deletion %d: %v", deletion.ID, err)
+			}
+		}
+
+		if len(deletions) < deletionBatchSize {
+			return nil
+		}
+	}
+}
+
+// deletionBackoff doubles the retry delay per attempt, up to an hour.
+func deletionBackoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < maxDeletionBackoff; i++ {
+		delay *= 2
 	}
+	return min(delay, maxDeletionBackoff)
 }
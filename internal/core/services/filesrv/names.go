@@ -0,0 +1,85 @@
+package filesrv
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxFileNameBytes = 255
+	defaultFileName  = "file"
+)
+
+// storageKey is where a file's content is stored. It is derived from the file
+// ID only, never from the user's filename, and sharded by the ID's leading
+// characters to keep directories small.
+func storageKey(fileID uuid.UUID) string {
+	id := fileID.String()
+	return fmt.Sprintf("%s/%s/%s", id[:2], id[2:4], id)
+}
+
+// thumbnailKey is where a thumbnail of a file is stored, next to the other
+// sizes of the same file.
+func thumbnailKey(fileID uuid.UUID, size, contentType string) string {
+	ext := ".png"
+	if contentType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return fmt.Sprintf("thumbnails/%s/%s%s", storageKey(fileID), size, ext)
+}
+
+// sanitizeFileName turns a client-supplied filename into a safe display name:
+// directories are dropped, the name is NFC-normalized, control and
+// bidirectional override characters are removed and the length is bounded.
+func sanitizeFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = norm.NFC.String(strings.ToValidUTF8(name, ""))
+
+	var b strings.Builder
+	lastSpace := false
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) || r == utf8.RuneError:
+			continue
+		case unicode.IsSpace(r):
+			if !lastSpace {
+				b.WriteRune(' ')
+			}
+			lastSpace = true
+			continue
+		}
+		b.WriteRune(r)
+		lastSpace = false
+	}
+	name = strings.Trim(b.String(), " .")
+
+	if len(name) > maxFileNameBytes {
+		name = truncateFileName(name)
+	}
+	if name == "" {
+		return defaultFileName
+	}
+	return name
+}
+
+// truncateFileName shortens the name to maxFileNameBytes on a rune boundary,
+// keeping a short extension intact.
+func truncateFileName(name string) string {
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i <= 16 {
+		name, ext = name[:i], name[i:]
+	}
+	limit := maxFileNameBytes - len(ext)
+	for len(name) > limit {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name + ext
+}
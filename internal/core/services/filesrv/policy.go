@@ -0,0 +1,104 @@
+package filesrv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// sniffLen is how much of the content is read to detect its type.
+const sniffLen = 3072
+
+var (
+	ErrUploadTooLarge     = errors.New("file exceeds the maximum upload size")
+	ErrFileTypeNotAllowed = errors.New("file type not allowed")
+	ErrContentMismatch    = errors.New("file content does not match its extension")
+)
+
+// MaxUploadSize returns the largest file that may be uploaded, or 0 if there
+// is no limit.
+func (s *FileService) MaxUploadSize() int64 {
+	return s.policy.MaxSize
+}
+
+func (s *FileService) checkUploadSize(size int64) error {
+	if s.policy.MaxSize > 0 && size > s.policy.MaxSize {
+		return ErrUploadTooLarge
+	}
+	return nil
+}
+
+// sniffContent detects the MIME type of content and checks it against the
+// upload policy and the file's extension. The returned reader yields the
+// full content, including the bytes read for detection.
+func (s *FileService) sniffContent(fileName string, content io.Reader) (*mimetype.MIME, io.Reader, error) {
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	header = header[:n]
+	detected := mimetype.Detect(header)
+
+	if matchesAny(detected, s.policy.DeniedTypes) {
+		return nil, nil, ErrFileTypeNotAllowed
+	}
+	if len(s.policy.AllowedTypes) > 0 && !matchesAny(detected, s.policy.AllowedTypes) {
+		return nil, nil, ErrFileTypeNotAllowed
+	}
+	if !matchesExtension(detected, strings.ToLower(path.Ext(fileName))) {
+		return nil, nil, ErrContentMismatch
+	}
+
+	return detected, io.MultiReader(bytes.NewReader(header), content), nil
+}
+
+// matchesAny reports whether the type or any type it is a kind of, such as
+// application/zip for a .docx, matches one of the patterns.
+func matchesAny(detected *mimetype.MIME, patterns []string) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		for _, pattern := range patterns {
+			if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+				if strings.HasPrefix(m.String(), prefix+"/") {
+					return true
+				}
+			} else if m.Is(pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesExtension rejects content whose type contradicts a well-known
+// extension, such as an executable named .pdf. Extensions without a known
+// type cannot be judged and are accepted.
+func matchesExtension(detected *mimetype.MIME, ext string) bool {
+	expected, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if ext == "" || expected == "" {
+		return true
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Extension() == ext || m.Is(expected) {
+			return true
+		}
+	}
+	// Detection may stop at a more general format, such as application/zip
+	// for a .docx or text/plain for malformed JSON
+	if detected.Parent() == nil {
+		return false
+	}
+	if known := mimetype.Lookup(expected); known != nil {
+		for m := known.Parent(); m != nil; m = m.Parent() {
+			if m.Is(detected.String()) {
+				return true
+			}
+		}
+	}
+	return strings.HasPrefix(expected, "text/") && detected.Is("text/plain")
+}
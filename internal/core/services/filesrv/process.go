@@ -0,0 +1,169 @@
+package filesrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/jobsrv"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// ProcessUpload does the work on a new file that need not hold up the
+// upload: it verifies the stored content, scans it for malware and makes
+// thumbnails of clean images. It runs from the job queue, possibly more than
+// once.
+func (s *FileService) ProcessUpload(ctx context.Context, payload domain.FileJob) error {
+	file, err := s.fileRepo.GetByID(ctx, payload.FileID)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		// Deleted before its job ran; there is nothing left to process
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+
+	switch file.ScanStatus {
+	case domain.ScanStatusPending:
+		object, err := s.storage.Checksum(file.URL)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if file.SHA256 != "" && object.SHA256 != file.SHA256 {
+			log.Printf("File %s does not match its checksum after upload", file.ID)
+			return jobsrv.Permanent(fmt.Errorf("stored content of file %s does not match its checksum", file.ID))
+		}
+		if err := s.scanFile(ctx, file); err != nil {
+			return err
+		}
+	case domain.ScanStatusInfected:
+		// An earlier run found malware but did not get to move the blob
+		return s.quarantineBlob(ctx, file)
+	}
+
+	if file.ScanStatus != domain.ScanStatusClean {
+		return nil
+	}
+	return s.generateThumbnails(ctx, file)
+}
+
+// scanFile marks the file clean or infected. An infected file stays listed
+// for its owner, who is notified, but its blob is quarantined.
+func (s *FileService) scanFile(ctx context.Context, file *domain.File) error {
+	path, err := s.storage.Get(file.URL)
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+	content, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	signature, err := s.scanner.Scan(ctx, content)
+	content.Close()
+	if err != nil {
+		return fmt.Errorf("failed to scan file: %w", err)
+	}
+
+	status := domain.ScanStatusClean
+	if signature != "" {
+		status = domain.ScanStatusInfected
+	}
+	if err := s.fileRepo.UpdateScanStatus(ctx, file.ID, status, signature, time.Now()); err != nil {
+		return fmt.Errorf("failed to record scan result: %w", err)
+	}
+	s.EvictFile(ctx, file.ID)
+	file.ScanStatus = status
+	if signature == "" {
+		return nil
+	}
+
+	log.Printf("File %s of user %s is infected with %s, quarantining it", file.ID, file.UserID, signature)
+	s.notifyInfected(ctx, file, signature)
+	return s.quarantineBlob(ctx, file)
+}
+
+// quarantineBlob moves the blob out of reach and records its new key on the
+// file, so deleting the file removes it. If the file was deleted meanwhile
+// the quarantined blob is queued for removal right away.
+func (s *FileService) quarantineBlob(ctx context.Context, file *domain.File) error {
+	key, err := s.storage.Quarantine(file.URL)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to quarantine file: %w", err)
+	}
+
+	ok, err := s.fileRepo.SetQuarantineKey(ctx, file.ID, key)
+	if err != nil {
+		return fmt.Errorf("failed to record quarantine of file %s at %s: %w", file.ID, key, err)
+	}
+	if !ok {
+		if err := s.deletions.Create(ctx, &domain.BlobDeletion{
+			StorageKey:    key,
+			FileID:        &file.ID,
+			Reason:        domain.BlobDeletionFile,
+			NextAttemptAt: time.Now(),
+		}); err != nil {
+			return fmt.Errorf("failed to schedule removal of %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileService) notifyInfected(ctx context.Context, file *domain.File, signature string) {
+	user, err := s.userRepo.GetByID(ctx, file.UserID)
+	if err != nil {
+		log.Printf("Error getting owner of infected file %s: %v", file.ID, err)
+		return
+	}
+	body := fmt.Sprintf("The file %s you uploaded to your filesms account on %s contains malware (%s).\n\n"+
+		"It has been quarantined and cannot be shared or downloaded. You can delete it from your files.",
+		file.Name, file.CreatedAt.Format(time.RFC1123), signature)
+	if err := s.mailer.Send(ctx, user.Email, "Malware found in an uploaded file", body); err != nil {
+		log.Printf("Error notifying owner of infected file %s: %v", file.ID, err)
+	}
+}
+
+// Retries with backoff ride out about an hour and a half of scanner
+// outage before the job is given up
+const processingAttempts = 10
+
+// enqueueProcessing schedules ProcessUpload for a new file. The upload has
+// succeeded either way, so failures are only logged; RequeueUnprocessed
+// picks the file up later.
+func (s *FileService) enqueueProcessing(ctx context.Context, file *domain.File) {
+	opts := jobsrv.EnqueueOptions{MaxAttempts: processingAttempts}
+	if _, err := s.jobs.Enqueue(ctx, domain.JobFileUploaded, domain.FileJob{FileID: file.ID}, opts); err != nil {
+		log.Printf("Error enqueuing processing of file %s: %v", file.ID, err)
+	}
+}
+
+const (
+	// Uploads are queued right after their row is committed, so a file
+	// without a job after this long lost it
+	requeueDelay     = 10 * time.Minute
+	requeueBatchSize = 500
+)
+
+// RequeueUnprocessed queues processing for files still waiting for a scan
+// whose job was never queued, because enqueueing failed or the process
+// stopped right after the upload.
+func (s *FileService) RequeueUnprocessed(ctx context.Context) error {
+	files, err := s.fileRepo.GetUnprocessed(ctx, time.Now().Add(-requeueDelay), requeueBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get unprocessed files: %w", err)
+	}
+	opts := jobsrv.EnqueueOptions{MaxAttempts: processingAttempts}
+	for _, file := range files {
+		if _, err := s.jobs.Enqueue(ctx, domain.JobFileUploaded, domain.FileJob{FileID: file.ID}, opts); err != nil {
+			return fmt.Errorf("failed to enqueue processing of file %s: %w", file.ID, err)
+		}
+	}
+	if len(files) > 0 {
+		log.Printf("Queued processing of %d files that had no job", len(files))
+	}
+	return nil
+}
@@ -7,68 +7,183 @@ import (
 	"errors"
 	"filesms/internal/core/domain"
 	"filesms/internal/core/ports"
+	"filesms/internal/core/services/jobsrv"
 	"filesms/pkg/cache/redis"
+	"filesms/pkg/presign"
 	"filesms/pkg/storage"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	defaultUploadURLExpiry = 15 * time.Minute
+	maxUploadURLExpiry     = 24 * time.Hour
+	// An upload still uncommitted after this long is assumed dead and its
+	// blob is removed. It must exceed the longest upload we accept.
+	uploadDeletionDelay = 6 * time.Hour
+)
+
+var (
+	ErrUploadURLInvalid  = errors.New("invalid or expired upload url")
+	ErrUploadURLUsed     = errors.New("upload url already used")
+	ErrUploadSizeInvalid = errors.New("uploaded content does not match declared size")
+	ErrFileTooLarge      = errors.New("file is larger than the storage quota")
+	ErrQuotaExceeded     = errors.New("storage quota exceeded")
+	ErrChecksumMismatch  = errors.New("content does not match expected checksum")
+	ErrFileLocked        = errors.New("file is under legal hold or retention")
+	ErrFileNotClean      = errors.New("file has not passed the malware scan")
+	ErrUnauthorized      = errors.New("unauthorized access to file")
+	ErrAccountDisabled   = errors.New("account disabled")
+)
+
 type FileService struct {
-	fileRepo ports.FileRepository
-	storage  *storage.LocalStorage
-	baseURL  string
-	cache    *redis.RedisCache
+	fileRepo     ports.FileRepository
+	userRepo     ports.UserRepository
+	deletions    ports.BlobDeletionRepository
+	policies     ports.LifecyclePolicyRepository
+	thumbnails   ports.ThumbnailRepository
+	jobs         *jobsrv.JobService
+	revocations  ports.Revocations
+	scanner      ports.Scanner
+	mailer       ports.Mailer
+	storage      *storage.LocalStorage
+	baseURL      string
+	cache        *redis.RedisCache
+	signer       *presign.Signer
+	defaultQuota int64
+	policy       domain.UploadPolicy
+	// defaultRetention applies to files no lifecycle policy covers
+	defaultRetention time.Duration
+
+	// decodeSlots bounds how many images are decoded at once
+	decodeSlots    chan struct{}
+	thumbnailMu    sync.Mutex
+	thumbnailCalls map[string]*thumbnailCall
 }
 
-func NewFileService(fileRepo ports.FileRepository, storage *storage.LocalStorage, baseURL string, cache *redis.RedisCache) *FileService {
+func NewFileService(fileRepo ports.FileRepository, userRepo ports.UserRepository, deletions ports.BlobDeletionRepository, policies ports.LifecyclePolicyRepository, thumbnails ports.ThumbnailRepository, jobs *jobsrv.JobService, revocations ports.Revocations, scanner ports.Scanner, mailer ports.Mailer, storage *storage.LocalStorage, baseURL string, cache *redis.RedisCache, signer *presign.Signer, defaultQuota int64, policy domain.UploadPolicy, defaultRetention time.Duration) *FileService {
 	return &FileService{
-		fileRepo: fileRepo,
-		storage:  storage,
-		baseURL:  baseURL,
-		cache:    cache,
+		fileRepo:         fileRepo,
+		userRepo:         userRepo,
+		deletions:        deletions,
+		policies:         policies,
+		thumbnails:       thumbnails,
+		jobs:             jobs,
+		revocations:      revocations,
+		scanner:          scanner,
+		mailer:           mailer,
+		storage:          storage,
+		baseURL:          baseURL,
+		cache:            cache,
+		signer:           signer,
+		defaultQuota:     defaultQuota,
+		policy:           policy,
+		defaultRetention: defaultRetention,
+		decodeSlots:      make(chan struct{}, maxConcurrentDecodes),
+		thumbnailCalls:   make(map[string]*thumbnailCall),
 	}
 }
 
-func (s *FileService) Upload(ctx context.Context, userID uuid.UUID, fileName string, content io.Reader, fileSize int64) (*domain.File, error) {
-	// Generate a unique filename
-	uniqueFileName := fmt.Sprintf("%d_%s", time.Now().UnixNano(), fileName)
+// Upload stores content as a new file of the user. The size and SHA-256 are
+// taken from the stored bytes; a non-empty expectedSHA256 (hex) must match.
+// A non-nil retention replaces the lifecycle policies for this file.
+func (s *FileService) Upload(ctx context.Context, userID uuid.UUID, fileName string, content io.Reader, fileSize int64, expectedSHA256 string, retention *domain.Retention) (*domain.File, error) {
+	if err := s.checkUploadSize(fileSize); err != nil {
+		return nil, err
+	}
+	fileName = sanitizeFileName(fileName)
+	detected, content, err := s.sniffContent(fileName, content)
+	if err != nil {
+		return nil, err
+	}
+	var policies []*domain.LifecyclePolicy
+	if retention == nil {
+		if policies, err = s.policies.GetApplicable(ctx, userID); err != nil {
+			return nil, fmt.Errorf("failed to get lifecycle policies: %w", err)
+		}
+	}
+	if err := s.reserveStorage(ctx, userID, fileSize); err != nil {
+		return nil, err
+	}
+
+	// The storage key is derived from the file ID, never from the user's filename
+	fileID := uuid.New()
+	key := storageKey(fileID)
+	// Schedule the blob's removal before writing it, so a crash before the
+	// row is committed cannot leave it behind. Create cancels this.
+	if err := s.deletions.Create(ctx, &domain.BlobDeletion{
+		StorageKey:    key,
+		FileID:        &fileID,
+		Reason:        domain.BlobDeletionUpload,
+		NextAttemptAt: time.Now().Add(uploadDeletionDelay),
+	}); err != nil {
+		s.releaseStorage(ctx, userID, fileSize)
+		return nil, fmt.Errorf("failed to schedule upload: %w", err)
+	}
 	// Save the file to local storage
-	_, err := s.storage.Save(uniqueFileName, content)
+	object, err := s.storage.Save(key, content, strings.ToLower(expectedSHA256))
 	if err != nil {
+		s.releaseStorage(ctx, userID, fileSize)
+		if errors.Is(err, storage.ErrChecksumMismatch) {
+			return nil, ErrChecksumMismatch
+		}
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
+	// Only the declared size was reserved, so anything else is refused
+	if object.Size != fileSize {
+		_ = s.storage.Delete(key)
+		s.releaseStorage(ctx, userID, fileSize)
+		return nil, ErrUploadSizeInvalid
+	}
 
-	fmt.Println("File saved! ", uniqueFileName)
 	// Create file metadata
 	file := &domain.File{
-		UserID:    userID,
-		Name:      fileName,
-		Size:      fileSize,
-		Type:      filepath.Ext(fileName),
-		URL:       uniqueFileName,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		ID:        uuid.New(),
+		UserID:     userID,
+		Name:       fileName,
+		Size:       object.Size,
+		Type:       filepath.Ext(fileName),
+		MIMEType:   detected.String(),
+		SHA256:     object.SHA256,
+		URL:        key,
+		ScanStatus: domain.ScanStatusPending,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		ID:         fileID,
+	}
+	if retention != nil {
+		file.ExpirationPinned = true
+		if !retention.Never {
+			expiresAt := file.CreatedAt.Add(retention.Duration)
+			file.ExpirationDate = &expiresAt
+		}
+	} else {
+		file.ExpirationDate = domain.ResolveExpiration(policies, file, s.defaultRetention)
 	}
 
 	// Save file metadata to database
 	err = s.fileRepo.Create(ctx, file)
-	fmt.Println(err)
 	if err != nil {
-		// If database insert fails, delete the file from storage
-		_ = s.storage.Delete(uniqueFileName)
+		// The scheduled deletion is still pending and will retry this
+		_ = s.storage.Delete(key)
+		s.releaseStorage(ctx, userID, fileSize)
 		return nil, fmt.Errorf("failed to save file metadata: %w", err)
 	}
+	s.enqueueProcessing(ctx, file)
 
 	return file, nil
 }
 func (s *FileService) GetFile(ctx context.Context, fileID uuid.UUID) (*domain.File, error) {
-	cacheKey := fmt.Sprintf("file:%d", fileID)
+	cacheKey := fileCacheKey(fileID)
 
 	// Try to get the file from cache
 	var file domain.File
@@ -94,6 +209,14 @@ func (s *FileService) GetFile(ctx context.Context, fileID uuid.UUID) (*domain.Fi
 	return filePtr, nil
 }
 
+// RecordAccess notes that the owner read the file, so last-access lifecycle
+// policies count it.
+func (s *FileService) RecordAccess(ctx context.Context, fileID uuid.UUID) {
+	if err := s.fileRepo.TouchAccess(ctx, fileID, time.Now()); err != nil {
+		log.Printf("Error recording file access: %v", err)
+	}
+}
+
 func (s *FileService) GetFileByID(ctx context.Context, fileID uuid.UUID) (*domain.File, error) {
 	return s.fileRepo.GetByID(ctx, fileID)
 }
@@ -104,7 +227,10 @@ func (s *FileService) ShareFile(ctx context.Context, fileID uuid.UUID, userID uu
 	}
 
 	if file.UserID != userID {
-		return "", errors.New("unauthorized access to file")
+		return "", ErrUnauthorized
+	}
+	if file.ScanStatus != domain.ScanStatusClean {
+		return "", ErrFileNotClean
 	}
 
 	// Generate a unique token for the shared URL
@@ -137,3 +263,278 @@ func (s *FileService) SearchFiles(ctx context.Context, userID uuid.UUID, params
 func (s *FileService) GetFiles(ctx context.Context, userID uuid.UUID) ([]*domain.File, error) {
 	return s.fileRepo.GetByUserID(ctx, userID)
 }
+
+// GetUsage reports the user's stored bytes and files against their quota.
+func (s *FileService) GetUsage(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.fileRepo.GetUsageByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage.QuotaBytes = s.quotaFor(user)
+	return usage, nil
+}
+
+// PresignUpload returns a signed URL the client can PUT the declared file to
+// without presenting a bearer token.
+func (s *FileService) PresignUpload(ctx context.Context, userID uuid.UUID, name string, size int64, contentType, sha256 string, retention *domain.Retention, expiresIn time.Duration) (*domain.DirectUpload, error) {
+	if expiresIn <= 0 {
+		expiresIn = defaultUploadURLExpiry
+	}
+	if expiresIn > maxUploadURLExpiry {
+		expiresIn = maxUploadURLExpiry
+	}
+
+	if err := s.checkUploadSize(size); err != nil {
+		return nil, err
+	}
+	// Space is only reserved once the content arrives, this rejects uploads
+	// that could not fit anyway
+	usage, err := s.GetUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if size > usage.QuotaBytes {
+		return nil, ErrFileTooLarge
+	}
+	if usage.TotalBytes+size > usage.QuotaBytes {
+		return nil, ErrQuotaExceeded
+	}
+
+	upload := &domain.DirectUpload{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        name,
+		Size:        size,
+		ContentType: contentType,
+		SHA256:      strings.ToLower(sha256),
+		Method:      http.MethodPut,
+		ExpiresAt:   time.Now().Add(expiresIn).Truncate(time.Second),
+	}
+	issuedAt := time.Now()
+	if retention != nil {
+		upload.Retention = retention.String()
+	}
+
+	values := url.Values{}
+	values.Set("upload_id", upload.ID.String())
+	values.Set("user_id", upload.UserID.String())
+	values.Set("name", upload.Name)
+	values.Set("size", strconv.FormatInt(upload.Size, 10))
+	values.Set("content_type", upload.ContentType)
+	values.Set("issued_at", strconv.FormatInt(issuedAt.Unix(), 10))
+	if upload.SHA256 != "" {
+		values.Set("sha256", upload.SHA256)
+	}
+	if upload.Retention != "" {
+		values.Set("retention", upload.Retention)
+	}
+	upload.UploadURL = fmt.Sprintf("%s/direct-upload?%s", s.baseURL, s.signer.Sign(values, upload.ExpiresAt))
+
+	return upload, nil
+}
+
+// CompleteDirectUpload verifies a signed upload URL and stores content as the
+// declared file. Each URL stores at most one file; a failed upload can be
+// retried with the same URL.
+func (s *FileService) CompleteDirectUpload(ctx context.Context, values url.Values, contentType string, content io.Reader) (*domain.File, error) {
+	if err := s.signer.Verify(values); err != nil {
+		return nil, ErrUploadURLInvalid
+	}
+
+	upload, err := parseDirectUpload(values)
+	if err != nil {
+		return nil, ErrUploadURLInvalid
+	}
+	if contentType != upload.ContentType {
+		return nil, ErrUploadURLInvalid
+	}
+	if err := s.checkUploader(ctx, upload.UserID, values); err != nil {
+		return nil, err
+	}
+
+	var retention *domain.Retention
+	if upload.Retention != "" {
+		if retention, err = domain.ParseRetention(upload.Retention); err != nil {
+			return nil, ErrUploadURLInvalid
+		}
+	}
+
+	// Claim the upload before reading the body so a URL cannot be replayed
+	claimKey := fmt.Sprintf("direct_upload:%s", upload.ID)
+	ok, err := s.cache.SetNX(ctx, claimKey, upload.UserID, time.Until(upload.ExpiresAt)+time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim upload: %w", err)
+	}
+	if !ok {
+		return nil, ErrUploadURLUsed
+	}
+
+	file, err := s.Upload(ctx, upload.UserID, upload.Name, &exactSizeReader{r: content, remaining: upload.Size}, upload.Size, upload.SHA256, retention)
+	if err != nil {
+		// No file was stored, so the URL may be retried. The request may have
+		// been cancelled by a dropped connection, the release must not be.
+		if err := s.cache.Delete(context.WithoutCancel(ctx), claimKey); err != nil {
+			log.Printf("Error releasing upload %s: %v", upload.ID, err)
+		}
+		if errors.Is(err, ErrUploadSizeInvalid) {
+			return nil, ErrUploadSizeInvalid
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// checkUploader refuses upload URLs of disabled users and URLs issued before
+// the user last signed out everywhere, which only LogoutAll can revoke.
+func (s *FileService) checkUploader(ctx context.Context, userID uuid.UUID, values url.Values) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return ErrUploadURLInvalid
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.Disabled {
+		return ErrAccountDisabled
+	}
+
+	issued, err := strconv.ParseInt(values.Get("issued_at"), 10, 64)
+	if err != nil {
+		return ErrUploadURLInvalid
+	}
+	cutoff, err := s.revocations.RevokedUntil(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check revocation: %w", err)
+	}
+	if !cutoff.IsZero() && !time.Unix(issued, 0).After(cutoff) {
+		return ErrUploadURLInvalid
+	}
+	return nil
+}
+
+func parseDirectUpload(values url.Values) (*domain.DirectUpload, error) {
+	id, err := uuid.Parse(values.Get("upload_id"))
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(values.Get("user_id"))
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(values.Get("size"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	expires, err := strconv.ParseInt(values.Get(presign.ExpiresParam), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.DirectUpload{
+		ID:          id,
+		UserID:      userID,
+		Name:        values.Get("name"),
+		Size:        size,
+		ContentType: values.Get("content_type"),
+		SHA256:      values.Get("sha256"),
+		Retention:   values.Get("retention"),
+		ExpiresAt:   time.Unix(expires, 0),
+	}, nil
+}
+
+// exactSizeReader fails the read when the content is longer or shorter than
+// the declared size.
+type exactSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (e *exactSizeReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > e.remaining+1 {
+		p = p[:e.remaining+1]
+	}
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	if e.remaining < 0 {
+		return n, ErrUploadSizeInvalid
+	}
+	if err == io.EOF && e.remaining > 0 {
+		return n, ErrUploadSizeInvalid
+	}
+	return n, err
+}
+
+// DeleteFiles removes the files' metadata and cached copies. The blobs are
+// queued for removal with the metadata and deleted by the cleanup worker.
+// Nothing is deleted if any of the files is locked.
+func (s *FileService) DeleteFiles(ctx context.Context, files []*domain.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	fileIDs := make([]uuid.UUID, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.ID
+	}
+	locked, err := s.fileRepo.CountLocked(ctx, fileIDs)
+	if err != nil {
+		return fmt.Errorf("failed to check file locks: %w", err)
+	}
+	if locked > 0 {
+		return ErrFileLocked
+	}
+	if err := s.fileRepo.DeleteFiles(ctx, fileIDs); err != nil {
+		return fmt.Errorf("failed to delete file metadata: %w", err)
+	}
+
+	for _, file := range files {
+		s.EvictFile(ctx, file.ID)
+	}
+	return nil
+}
+
+// EvictFile drops the cached metadata of a file that changed.
+func (s *FileService) EvictFile(ctx context.Context, fileID uuid.UUID) {
+	if err := s.cache.Delete(ctx, fileCacheKey(fileID)); err != nil {
+		log.Printf("Error evicting cached file %s: %v", fileID, err)
+	}
+}
+
+// reserveStorage claims size bytes of the user's quota for an upload.
+func (s *FileService) reserveStorage(ctx context.Context, userID uuid.UUID, size int64) error {
+	ok, err := s.userRepo.ReserveStorage(ctx, userID, size, s.defaultQuota)
+	if err != nil {
+		return fmt.Errorf("failed to reserve storage: %w", err)
+	}
+	if ok {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if size > s.quotaFor(user) {
+		return ErrFileTooLarge
+	}
+	return ErrQuotaExceeded
+}
+
+func (s *FileService) releaseStorage(ctx context.Context, userID uuid.UUID, size int64) {
+	if err := s.userRepo.ReleaseStorage(ctx, userID, size); err != nil {
+		log.Printf("Error releasing %d bytes of storage for user %s: %v", size, userID, err)
+	}
+}
+
+func (s *FileService) quotaFor(user *domain.User) int64 {
+	if user.StorageQuota != nil {
+		return *user.StorageQuota
+	}
+	return s.defaultQuota
+}
+
+func fileCacheKey(fileID uuid.UUID) string {
+	return fmt.Sprintf("file:%d", fileID)
+}
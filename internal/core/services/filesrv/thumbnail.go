@@ -0,0 +1,225 @@
+package filesrv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/pkg/thumbnail"
+	"fmt"
+	"image"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// A decoded image can take several hundred megabytes, so only this many are
+// held in memory at once
+const maxConcurrentDecodes = 2
+
+var (
+	ErrThumbnailSize = errors.New("unknown thumbnail size")
+	ErrNoThumbnail   = errors.New("no thumbnail can be made of this file")
+)
+
+// thumbnailCall is a thumbnail being generated, which concurrent requests
+// for the same file and size wait for instead of decoding the image again.
+type thumbnailCall struct {
+	done  chan struct{}
+	thumb *domain.Thumbnail
+	err   error
+}
+
+// GetThumbnail returns a thumbnail of the user's image file and the path of
+// its blob. A thumbnail that was never generated, or whose blob is gone, is
+// generated on the spot.
+func (s *FileService) GetThumbnail(ctx context.Context, userID, fileID uuid.UUID, size string) (*domain.Thumbnail, string, error) {
+	if _, ok := domain.ThumbnailSizes[size]; !ok {
+		return nil, "", ErrThumbnailSize
+	}
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get file: %w", err)
+	}
+	if file.UserID != userID {
+		return nil, "", ErrUnauthorized
+	}
+	if file.ScanStatus != domain.ScanStatusClean {
+		return nil, "", ErrFileNotClean
+	}
+	if !domain.ThumbnailMIMETypes[file.MIMEType] {
+		return nil, "", ErrNoThumbnail
+	}
+
+	if existing, err := s.thumbnails.Get(ctx, fileID, size); err == nil {
+		if path, err := s.storage.Get(existing.StorageKey); err == nil {
+			return existing, path, nil
+		}
+	}
+
+	thumb, err := s.generateThumbnail(ctx, file, size)
+	if err != nil {
+		return nil, "", err
+	}
+	path, err := s.storage.Get(thumb.StorageKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get thumbnail: %w", err)
+	}
+	return thumb, path, nil
+}
+
+// generateThumbnail makes one thumbnail on request. Requests for the same
+// thumbnail share a single generation, which finishes even if the request
+// that started it goes away.
+func (s *FileService) generateThumbnail(ctx context.Context, file *domain.File, size string) (*domain.Thumbnail, error) {
+	key := file.ID.String() + "/" + size
+	s.thumbnailMu.Lock()
+	call, ok := s.thumbnailCalls[key]
+	if !ok {
+		call = &thumbnailCall{done: make(chan struct{})}
+		s.thumbnailCalls[key] = call
+		go func() {
+			thumbs, err := s.makeThumbnails(context.WithoutCancel(ctx), file, []string{size})
+			if err == nil {
+				call.thumb = thumbs[0]
+			}
+			call.err = err
+			s.thumbnailMu.Lock()
+			delete(s.thumbnailCalls, key)
+			s.thumbnailMu.Unlock()
+			close(call.done)
+		}()
+	}
+	s.thumbnailMu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.thumb, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// generateThumbnails makes the missing thumbnails of a clean image file.
+// Images that cannot be decoded are skipped; they have no thumbnails.
+func (s *FileService) generateThumbnails(ctx context.Context, file *domain.File) error {
+	if !domain.ThumbnailMIMETypes[file.MIMEType] {
+		return nil
+	}
+	existing, err := s.thumbnails.GetByFileID(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get thumbnails: %w", err)
+	}
+	missing := make(map[string]bool, len(domain.ThumbnailSizes))
+	for size := range domain.ThumbnailSizes {
+		missing[size] = true
+	}
+	for _, thumb := range existing {
+		delete(missing, thumb.Size)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	_, err = s.makeThumbnails(ctx, file, slices.Sorted(maps.Keys(missing)))
+	if errors.Is(err, ErrNoThumbnail) {
+		log.Printf("Not generating thumbnails of file %s: %v", file.ID, err)
+		return nil
+	}
+	return err
+}
+
+// makeThumbnails decodes the file's image once and saves a thumbnail for
+// each size. Images found not to be usable are recorded, so later calls
+// return ErrNoThumbnail without decoding them again.
+func (s *FileService) makeThumbnails(ctx context.Context, file *domain.File, sizes []string) ([]*domain.Thumbnail, error) {
+	failed, err := s.thumbnails.HasFailed(ctx, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check thumbnail failures: %w", err)
+	}
+	if failed {
+		return nil, ErrNoThumbnail
+	}
+
+	select {
+	case s.decodeSlots <- struct{}{}:
+		defer func() { <-s.decodeSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	img, orientation, err := s.decodeImage(file)
+	if errors.Is(err, ErrNoThumbnail) {
+		if merr := s.thumbnails.MarkFailed(ctx, file.ID, err.Error()); merr != nil {
+			log.Printf("Error recording thumbnail failure of file %s: %v", file.ID, merr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	thumbs := make([]*domain.Thumbnail, 0, len(sizes))
+	for _, size := range sizes {
+		thumb, err := s.saveThumbnail(ctx, file, size, img, orientation)
+		if err != nil {
+			return nil, err
+		}
+		thumbs = append(thumbs, thumb)
+	}
+	return thumbs, nil
+}
+
+// decodeImage reads the file's image. Content that is not a usable image is
+// reported as ErrNoThumbnail.
+func (s *FileService) decodeImage(file *domain.File) (image.Image, int, error) {
+	path, err := s.storage.Get(file.URL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get file: %w", err)
+	}
+	content, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer content.Close()
+
+	img, orientation, err := thumbnail.Decode(content)
+	if errors.Is(err, thumbnail.ErrUnsupported) || errors.Is(err, thumbnail.ErrTooLarge) || errors.Is(err, thumbnail.ErrInvalid) {
+		return nil, 0, fmt.Errorf("%w: %v", ErrNoThumbnail, err)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	return img, orientation, nil
+}
+
+func (s *FileService) saveThumbnail(ctx context.Context, file *domain.File, size string, img image.Image, orientation int) (*domain.Thumbnail, error) {
+	scaled := thumbnail.Scale(img, domain.ThumbnailSizes[size], orientation)
+	var buf bytes.Buffer
+	contentType, err := thumbnail.Encode(&buf, scaled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	key := thumbnailKey(file.ID, size, contentType)
+	object, err := s.storage.Save(key, &buf, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to save thumbnail: %w", err)
+	}
+	thumb := &domain.Thumbnail{
+		FileID:     file.ID,
+		Size:       size,
+		StorageKey: key,
+		MIMEType:   contentType,
+		Width:      scaled.Bounds().Dx(),
+		Height:     scaled.Bounds().Dy(),
+		Bytes:      object.Size,
+	}
+	if err := s.thumbnails.Save(ctx, thumb); err != nil {
+		return nil, fmt.Errorf("failed to record thumbnail: %w", err)
+	}
+	return thumb, nil
+}
@@ -0,0 +1,241 @@
+package jobsrv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxAttempts = 5
+	// A job not finished within its lease is assumed lost and run again, so
+	// handlers must be idempotent
+	jobLease = 5 * time.Minute
+	// Handlers are cancelled well before the lease runs out, so one that
+	// honours its context still records its outcome before the job can be
+	// claimed again
+	jobTimeout      = 4 * time.Minute
+	minRetryDelay   = 10 * time.Second
+	maxRetryDelay   = time.Hour
+	pruneInterval   = time.Hour
+	succeededMaxAge = 7 * 24 * time.Hour
+)
+
+// Handler runs one job. Returning an error retries the job with backoff
+// unless it is wrapped with Permanent.
+type Handler func(ctx context.Context, job *domain.Job) error
+
+// Handle adapts a function taking a decoded payload to a Handler.
+func Handle[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, job *domain.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("invalid payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error retrying cannot fix; the job goes straight to
+// the dead-letter state.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// EnqueueOptions schedule a job. The zero value runs it as soon as possible
+// with the default number of attempts.
+type EnqueueOptions struct {
+	RunAt       time.Time
+	MaxAttempts int
+}
+
+// JobService is a persistent job queue backed by Postgres. Any number of
+// instances can run workers; each job is claimed by one of them at a time.
+type JobService struct {
+	jobRepo  ports.JobRepository
+	workerID string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewJobService(jobRepo ports.JobRepository) *JobService {
+	hostname, _ := os.Hostname()
+	return &JobService{
+		jobRepo:  jobRepo,
+		workerID: hostname + "/" + uuid.NewString(),
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for a job type. Workers only claim jobs of
+// registered types.
+func (s *JobService) Register(jobType string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[jobType] = handler
+}
+
+func (s *JobService) Enqueue(ctx context.Context, jobType string, payload interface{}, opts EnqueueOptions) (*domain.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+	now := time.Now()
+	job := &domain.Job{
+		Type:        jobType,
+		Payload:     data,
+		Status:      domain.JobStatusPending,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = defaultMaxAttempts
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	if err := s.jobRepo.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *JobService) SearchJobs(ctx context.Context, params domain.JobSearchParams) ([]*domain.Job, error) {
+	return s.jobRepo.Search(ctx, params)
+}
+
+func (s *JobService) GetJob(ctx context.Context, id int64) (*domain.Job, error) {
+	return s.jobRepo.GetByID(ctx, id)
+}
+
+// RetryJob requeues a dead job.
+func (s *JobService) RetryJob(ctx context.Context, id int64) error {
+	return s.jobRepo.Retry(ctx, id)
+}
+
+// Start runs the given number of workers, polling for due jobs every
+// pollInterval when idle, until ctx is cancelled.
+func (s *JobService) Start(ctx context.Context, workers int, pollInterval time.Duration) {
+	log.Printf("Starting %d job workers", workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, pollInterval)
+		}()
+	}
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if n, err := s.jobRepo.DeleteSucceeded(ctx, time.Now().Add(-succeededMaxAge)); err != nil {
+				log.Printf("Error pruning jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("Pruned %d succeeded jobs", n)
+			}
+		}
+	}
+}
+
+func (s *JobService) work(ctx context.Context, pollInterval time.Duration) {
+	for ctx.Err() == nil {
+		ran, err := s.runNext(ctx)
+		if err != nil {
+			log.Printf("Error running job: %v", err)
+		}
+		if ran {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// runNext claims and runs one job, reporting whether there was one.
+func (s *JobService) runNext(ctx context.Context) (bool, error) {
+	s.mu.RLock()
+	types := make([]string, 0, len(s.handlers))
+	for jobType := range s.handlers {
+		types = append(types, jobType)
+	}
+	s.mu.RUnlock()
+	if len(types) == 0 {
+		return false, nil
+	}
+
+	job, err := s.jobRepo.Claim(ctx, s.workerID, types, time.Now().Add(jobLease))
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	// A job whose lease ran out may come back with its attempts used up
+	if job.Attempts > job.MaxAttempts {
+		return true, s.jobRepo.Fail(ctx, job, "lease expired on the last attempt", nil)
+	}
+
+	s.mu.RLock()
+	handler := s.handlers[job.Type]
+	s.mu.RUnlock()
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	err = runHandler(jobCtx, handler, job)
+	cancel()
+	if err == nil {
+		return true, s.jobRepo.Complete(ctx, job)
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Printf("Job %d (%s) failed permanently after %d attempts: %v", job.ID, job.Type, job.Attempts, err)
+		return true, s.jobRepo.Fail(ctx, job, err.Error(), nil)
+	}
+	retryAt := time.Now().Add(retryDelay(job.Attempts))
+	log.Printf("Job %d (%s) failed, retrying at %s: %v", job.ID, job.Type, retryAt.Format(time.RFC3339), err)
+	return true, s.jobRepo.Fail(ctx, job, err.Error(), &retryAt)
+}
+
+// runHandler turns a panicking handler into a failed attempt.
+func runHandler(ctx context.Context, handler Handler, job *domain.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// retryDelay doubles the delay per attempt, up to an hour.
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
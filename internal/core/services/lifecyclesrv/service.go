@@ -0,0 +1,358 @@
+package lifecyclesrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/internal/core/services/filesrv"
+	"filesms/pkg/storage"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	batchSize = 500
+	// Cold blobs live under this key prefix, so the directory can be mounted
+	// on cheaper storage
+	coldKeyPrefix = "cold/"
+)
+
+var ErrInvalidPolicy = errors.New("invalid lifecycle policy")
+
+// LifecycleService applies lifecycle policies: it keeps each file's
+// expiration in line with the policies, moves files to the cold tier and
+// warns owners before their files expire. Expired files are deleted by the
+// cleanup service.
+type LifecycleService struct {
+	fileRepo         ports.FileRepository
+	policyRepo       ports.LifecyclePolicyRepository
+	userRepo         ports.UserRepository
+	storage          *storage.LocalStorage
+	fileService      *filesrv.FileService
+	mailer           ports.Mailer
+	defaultRetention time.Duration
+	notifyBefore     time.Duration
+}
+
+func NewLifecycleService(fileRepo ports.FileRepository, policyRepo ports.LifecyclePolicyRepository, userRepo ports.UserRepository, storage *storage.LocalStorage, fileService *filesrv.FileService, mailer ports.Mailer, defaultRetention, notifyBefore time.Duration) *LifecycleService {
+	return &LifecycleService{
+		fileRepo:         fileRepo,
+		policyRepo:       policyRepo,
+		userRepo:         userRepo,
+		storage:          storage,
+		fileService:      fileService,
+		mailer:           mailer,
+		defaultRetention: defaultRetention,
+		notifyBefore:     notifyBefore,
+	}
+}
+
+// CreatePolicy adds a policy for the user, or a global one for a nil userID.
+func (s *LifecycleService) CreatePolicy(ctx context.Context, userID *uuid.UUID, policy *domain.LifecyclePolicy) error {
+	if policy.Basis == "" {
+		policy.Basis = domain.LifecycleBasisCreated
+	}
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+	policy.ID = uuid.New()
+	policy.UserID = userID
+	policy.CreatedAt = time.Now()
+	return s.policyRepo.Create(ctx, policy)
+}
+
+func validatePolicy(policy *domain.LifecyclePolicy) error {
+	switch policy.Action {
+	case domain.LifecycleExpire, domain.LifecycleColdTier:
+		if policy.Days <= 0 {
+			return fmt.Errorf("%w: days must be positive", ErrInvalidPolicy)
+		}
+	case domain.LifecycleNeverExpire:
+		policy.Days = 0
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidPolicy, policy.Action)
+	}
+	if policy.Basis != domain.LifecycleBasisCreated && policy.Basis != domain.LifecycleBasisLastAccess {
+		return fmt.Errorf("%w: unknown basis %q", ErrInvalidPolicy, policy.Basis)
+	}
+	if policy.FileType != "" && !strings.HasPrefix(policy.FileType, ".") && !strings.Contains(policy.FileType, "/") {
+		return fmt.Errorf("%w: file type must be an extension or a MIME type", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+func (s *LifecycleService) ListPolicies(ctx context.Context, userID *uuid.UUID) ([]*domain.LifecyclePolicy, error) {
+	return s.policyRepo.GetByOwner(ctx, userID)
+}
+
+func (s *LifecycleService) DeletePolicy(ctx context.Context, id uuid.UUID, userID *uuid.UUID) error {
+	return s.policyRepo.Delete(ctx, id, userID)
+}
+
+// Preview reports which files would be deleted or moved to the cold tier
+// within the given time, for the user or for everyone with a nil userID.
+// Nothing is changed.
+func (s *LifecycleService) Preview(ctx context.Context, userID *uuid.UUID, within time.Duration) (*domain.LifecycleReport, error) {
+	now := time.Now()
+	report := &domain.LifecycleReport{
+		GeneratedAt: now,
+		Until:       now.Add(within),
+		Deletions:   []domain.LifecycleItem{},
+		Transitions: []domain.LifecycleItem{},
+	}
+
+	var policies []*domain.LifecyclePolicy
+	var err error
+	if userID != nil {
+		policies, err = s.policyRepo.GetApplicable(ctx, *userID)
+	} else {
+		policies, err = s.policyRepo.GetAll(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle policies: %w", err)
+	}
+	// Files under a hold are not deleted however long ago they expired
+	heldUsers := make(map[uuid.UUID]bool)
+	heldIDs, err := s.userRepo.GetLegalHoldIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get legal holds: %w", err)
+	}
+	for _, id := range heldIDs {
+		heldUsers[id] = true
+	}
+
+	index := indexPolicies(policies)
+	err = s.eachFile(ctx, userID, func(file *domain.File) error {
+		policies := index.forFile(file)
+		expiration := domain.ResolveExpiration(policies, file, s.defaultRetention)
+		if file.RetainUntil != nil && expiration != nil && expiration.Before(*file.RetainUntil) {
+			expiration = file.RetainUntil
+		}
+		if expiration != nil && !expiration.After(report.Until) && !file.LegalHold && !heldUsers[file.UserID] {
+			item := lifecycleItem(file, *expiration)
+			if policy := domain.SelectLifecyclePolicy(policies, file, domain.LifecycleExpire); policy != nil && !file.ExpirationPinned {
+				item.PolicyID = &policy.ID
+			}
+			report.Deletions = append(report.Deletions, item)
+		}
+		if policy := coldPolicy(policies, file); policy != nil && !policy.DueAt(file).After(report.Until) {
+			item := lifecycleItem(file, policy.DueAt(file))
+			item.PolicyID = &policy.ID
+			report.Transitions = append(report.Transitions, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Deletions, func(i, j int) bool { return report.Deletions[i].At.Before(report.Deletions[j].At) })
+	sort.Slice(report.Transitions, func(i, j int) bool { return report.Transitions[i].At.Before(report.Transitions[j].At) })
+	return report, nil
+}
+
+func lifecycleItem(file *domain.File, at time.Time) domain.LifecycleItem {
+	return domain.LifecycleItem{FileID: file.ID, UserID: file.UserID, Name: file.Name, Size: file.Size, At: at}
+}
+
+// policyIndex groups policies by owner, so each file is only checked against
+// the global policies and its owner's rather than every policy.
+type policyIndex struct {
+	global []*domain.LifecyclePolicy
+	byUser map[uuid.UUID][]*domain.LifecyclePolicy
+}
+
+func indexPolicies(policies []*domain.LifecyclePolicy) *policyIndex {
+	index := &policyIndex{byUser: make(map[uuid.UUID][]*domain.LifecyclePolicy)}
+	for _, p := range policies {
+		if p.UserID == nil {
+			index.global = append(index.global, p)
+		}
+	}
+	for _, p := range policies {
+		if p.UserID != nil {
+			if _, ok := index.byUser[*p.UserID]; !ok {
+				index.byUser[*p.UserID] = append([]*domain.LifecyclePolicy(nil), index.global...)
+			}
+			index.byUser[*p.UserID] = append(index.byUser[*p.UserID], p)
+		}
+	}
+	return index
+}
+
+// forFile returns the policies that can apply to file.
+func (i *policyIndex) forFile(file *domain.File) []*domain.LifecyclePolicy {
+	if policies, ok := i.byUser[file.UserID]; ok {
+		return policies
+	}
+	return i.global
+}
+
+// coldPolicy returns the cold tier policy for a file still in the standard
+// tier.
+func coldPolicy(policies []*domain.LifecyclePolicy, file *domain.File) *domain.LifecyclePolicy {
+	// Infected files have no blob left to move
+	if file.StorageClass == domain.StorageClassCold || file.ScanStatus == domain.ScanStatusInfected {
+		return nil
+	}
+	return domain.SelectLifecyclePolicy(policies, file, domain.LifecycleColdTier)
+}
+
+// eachFile calls fn for the user's files, or every file for a nil userID.
+func (s *LifecycleService) eachFile(ctx context.Context, userID *uuid.UUID, fn func(*domain.File) error) error {
+	if userID != nil {
+		files, err := s.fileRepo.GetByUserID(ctx, *userID)
+		if err != nil {
+			return fmt.Errorf("failed to get files: %w", err)
+		}
+		for _, file := range files {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	after := uuid.Nil
+	for {
+		files, err := s.fileRepo.GetBatch(ctx, after, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, file := range files {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+		if len(files) < batchSize {
+			return nil
+		}
+		after = files[len(files)-1].ID
+	}
+}
+
+// Apply updates expirations, moves due files to the cold tier and sends
+// pre-expiry notifications.
+func (s *LifecycleService) Apply(ctx context.Context) error {
+	policies, err := s.policyRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get lifecycle policies: %w", err)
+	}
+
+	now := time.Now()
+	updated, moved := 0, 0
+	index := indexPolicies(policies)
+	err = s.eachFile(ctx, nil, func(file *domain.File) error {
+		policies := index.forFile(file)
+		if expiration := domain.ResolveExpiration(policies, file, s.defaultRetention); !sameTime(expiration, file.ExpirationDate) {
+			if err := s.fileRepo.UpdateExpiration(ctx, file.ID, expiration); err != nil {
+				log.Printf("Error updating expiration of file %s: %v", file.ID, err)
+			} else {
+				s.fileService.EvictFile(ctx, file.ID)
+				updated++
+			}
+		}
+		if policy := coldPolicy(policies, file); policy != nil && !policy.DueAt(file).After(now) {
+			if err := s.moveToCold(ctx, file); err != nil {
+				log.Printf("Error moving file %s to cold storage: %v", file.ID, err)
+			} else {
+				moved++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if updated > 0 || moved > 0 {
+		log.Printf("Lifecycle: updated the expiration of %d files, moved %d files to cold storage", updated, moved)
+	}
+
+	return s.notifyExpiring(ctx)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	// The database keeps microseconds
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+// moveToCold copies the blob under the cold prefix, verifying its checksum,
+// and repoints the file. The old blob is removed through the deletion outbox.
+func (s *LifecycleService) moveToCold(ctx context.Context, file *domain.File) error {
+	path, err := s.storage.Get(file.URL)
+	if err != nil {
+		return err
+	}
+	content, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	newKey := coldKeyPrefix + strings.TrimPrefix(file.URL, coldKeyPrefix)
+	if _, err := s.storage.Save(newKey, content, file.SHA256); err != nil {
+		return err
+	}
+	moved, err := s.fileRepo.ChangeStorageClass(ctx, file.ID, file.URL, newKey, domain.StorageClassCold)
+	if err != nil {
+		_ = s.storage.Delete(newKey)
+		return err
+	}
+	if !moved {
+		_ = s.storage.Delete(newKey)
+		return errors.New("file was deleted or moved meanwhile")
+	}
+	s.fileService.EvictFile(ctx, file.ID)
+	return nil
+}
+
+// notifyExpiring emails each owner the files that expire within the notice
+// period, once per expiration date.
+func (s *LifecycleService) notifyExpiring(ctx context.Context) error {
+	if s.notifyBefore <= 0 {
+		return nil
+	}
+	files, err := s.fileRepo.GetExpiringUnnotified(ctx, time.Now().Add(s.notifyBefore))
+	if err != nil {
+		return fmt.Errorf("failed to get expiring files: %w", err)
+	}
+
+	byUser := make(map[uuid.UUID][]*domain.File)
+	for _, file := range files {
+		byUser[file.UserID] = append(byUser[file.UserID], file)
+	}
+	for userID, files := range byUser {
+		user, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			log.Printf("Error getting owner %s of expiring files: %v", userID, err)
+			continue
+		}
+
+		var body strings.Builder
+		body.WriteString("The following files in your filesms account will be deleted soon:\n\n")
+		fileIDs := make([]uuid.UUID, len(files))
+		for i, file := range files {
+			fmt.Fprintf(&body, "- %s (%s)\n", file.Name, file.ExpirationDate.Format(time.RFC1123))
+			fileIDs[i] = file.ID
+		}
+		body.WriteString("\nDownload anything you want to keep before then.")
+		if err := s.mailer.Send(ctx, user.Email, "Files expiring soon", body.String()); err != nil {
+			log.Printf("Error sending expiry notice to %s: %v", user.ID, err)
+			continue
+		}
+		if err := s.fileRepo.MarkExpiryNotified(ctx, fileIDs); err != nil {
+			log.Printf("Error marking expiry notice for %s: %v", user.ID, err)
+		}
+	}
+	return nil
+}
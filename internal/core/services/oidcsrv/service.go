@@ -0,0 +1,202 @@
+package oidcsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/internal/core/services/authsrv"
+	"filesms/pkg/cache/redis"
+	"filesms/pkg/oidc"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const loginStateDuration = 10 * time.Minute
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidState     = errors.New("invalid or expired login state")
+	ErrEmailNotVerified = errors.New("identity provider did not verify the email address")
+	// ErrAccountUnverified means a local account holds the email but never
+	// proved it owns the address, so it may belong to someone else
+	ErrAccountUnverified = errors.New("existing account has not verified its email address")
+)
+
+type OIDCService struct {
+	providers    map[string]*oidc.Provider
+	userRepo     ports.UserRepository
+	identityRepo ports.UserIdentityRepository
+	authService  *authsrv.AuthService
+	cache        *redis.RedisCache
+}
+
+type loginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func NewOIDCService(providers []*oidc.Provider, userRepo ports.UserRepository, identityRepo ports.UserIdentityRepository, authService *authsrv.AuthService, cache *redis.RedisCache) *OIDCService {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return &OIDCService{
+		providers:    byName,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		authService:  authService,
+		cache:        cache,
+	}
+}
+
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// BeginLogin returns the IdP authorization URL. State, nonce and the PKCE
+// verifier are kept server side until the callback.
+func (s *OIDCService) BeginLogin(ctx context.Context, providerName string) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.cache.Set(ctx, loginStateKey(state), loginState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}, loginStateDuration)
+	if err != nil {
+		return "", fmt.Errorf("failed to save login state: %w", err)
+	}
+
+	return provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+}
+
+// CompleteLogin handles the IdP callback: it exchanges the code, verifies the
+// ID token and signs in the linked, matched or newly provisioned user. Users
+// with two-factor authentication still have to complete its challenge.
+func (s *OIDCService) CompleteLogin(ctx context.Context, state, code string, client domain.ClientInfo) (*domain.LoginResult, error) {
+	var saved loginState
+	if err := s.cache.GetDel(ctx, loginStateKey(state), &saved); err != nil {
+		return nil, ErrInvalidState
+	}
+	provider, ok := s.providers[saved.Provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, saved.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := s.resolveUser(ctx, provider.Name(), claims)
+	if err != nil {
+		return nil, err
+	}
+	return s.authService.SignIn(ctx, userID, client)
+}
+
+func (s *OIDCService) resolveUser(ctx context.Context, providerName string, claims *oidc.Claims) (uuid.UUID, error) {
+	if identity, err := s.identityRepo.GetByIssuerSubject(ctx, claims.Issuer, claims.Subject); err == nil {
+		return identity.UserID, nil
+	}
+
+	// Linking or provisioning by email is only safe when the IdP vouches for it
+	if claims.Email == "" || !claims.EmailVerified {
+		return uuid.Nil, ErrEmailNotVerified
+	}
+	email := claims.Email
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		user, err = s.provisionUser(ctx, email)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		log.Printf("Provisioned user %s from identity provider %s", user.ID, providerName)
+	case err != nil:
+		return uuid.Nil, fmt.Errorf("failed to get user: %w", err)
+	case !user.EmailVerified:
+		// Anyone can register an address they do not own; linking would let
+		// them share the account with its real owner. A password reset proves
+		// ownership and signs the other party out.
+		return uuid.Nil, ErrAccountUnverified
+	default:
+		log.Printf("Linked user %s to identity provider %s", user.ID, providerName)
+	}
+
+	identity := &domain.UserIdentity{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Provider:  providerName,
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return user.ID, nil
+}
+
+// provisionUser creates a user with an unusable random password; they can
+// set one later through the password reset flow.
+func (s *OIDCService) provisionUser(ctx context.Context, email string) (*domain.User, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(fmt.Sprintf("%x", raw)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &domain.User{
+		ID:            uuid.New(),
+		Email:         email,
+		Password:      string(hashedPassword),
+		EmailVerified: true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+func loginStateKey(state string) string {
+	return fmt.Sprintf("oidc_state:%s", state)
+}
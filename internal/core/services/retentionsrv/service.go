@@ -0,0 +1,116 @@
+package retentionsrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/internal/core/services/filesrv"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRetentionShortened = errors.New("retention can only be extended")
+	ErrRetentionInPast    = errors.New("retention date must be in the future")
+)
+
+// RetentionService places and releases legal holds and retention locks.
+// Every change is recorded in the retention audit trail.
+type RetentionService struct {
+	retentionRepo ports.RetentionRepository
+	fileRepo      ports.FileRepository
+	userRepo      ports.UserRepository
+	fileService   *filesrv.FileService
+}
+
+func NewRetentionService(retentionRepo ports.RetentionRepository, fileRepo ports.FileRepository, userRepo ports.UserRepository, fileService *filesrv.FileService) *RetentionService {
+	return &RetentionService{
+		retentionRepo: retentionRepo,
+		fileRepo:      fileRepo,
+		userRepo:      userRepo,
+		fileService:   fileService,
+	}
+}
+
+func (s *RetentionService) SetFileLegalHold(ctx context.Context, adminID, fileID uuid.UUID, hold bool, reason string) (*domain.RetentionEvent, error) {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	event := newEvent(adminID, holdAction(hold), reason)
+	event.FileID = &file.ID
+	event.UserID = &file.UserID
+	if err := s.retentionRepo.SetFileLegalHold(ctx, file.ID, hold, event); err != nil {
+		return nil, fmt.Errorf("failed to set legal hold: %w", err)
+	}
+	s.fileService.EvictFile(ctx, file.ID)
+	log.Printf("Admin %s %s on file %s: %s", adminID, event.Action, file.ID, reason)
+	return event, nil
+}
+
+// SetUserLegalHold holds or releases everything of a user, including files
+// uploaded while the hold is in place, and blocks deleting the account.
+func (s *RetentionService) SetUserLegalHold(ctx context.Context, adminID, userID uuid.UUID, hold bool, reason string) (*domain.RetentionEvent, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	event := newEvent(adminID, holdAction(hold), reason)
+	event.UserID = &user.ID
+	if err := s.retentionRepo.SetUserLegalHold(ctx, user.ID, hold, event); err != nil {
+		return nil, fmt.Errorf("failed to set legal hold: %w", err)
+	}
+	log.Printf("Admin %s %s on user %s: %s", adminID, event.Action, user.ID, reason)
+	return event, nil
+}
+
+// ExtendRetention locks a file against modification and deletion until the
+// given time. Like an object lock in compliance mode it cannot be shortened
+// or removed, only extended.
+func (s *RetentionService) ExtendRetention(ctx context.Context, adminID, fileID uuid.UUID, until time.Time, reason string) (*domain.RetentionEvent, error) {
+	if !until.After(time.Now()) {
+		return nil, ErrRetentionInPast
+	}
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.RetainUntil != nil && until.Before(*file.RetainUntil) {
+		return nil, ErrRetentionShortened
+	}
+
+	event := newEvent(adminID, domain.RetentionExtended, reason)
+	event.FileID = &file.ID
+	event.UserID = &file.UserID
+	event.RetainUntil = &until
+	if err := s.retentionRepo.ExtendFileRetention(ctx, file.ID, until, event); err != nil {
+		return nil, fmt.Errorf("failed to extend retention: %w", err)
+	}
+	s.fileService.EvictFile(ctx, file.ID)
+	log.Printf("Admin %s retained file %s until %s: %s", adminID, file.ID, until.Format(time.RFC3339), reason)
+	return event, nil
+}
+
+func (s *RetentionService) GetEvents(ctx context.Context, fileID, userID *uuid.UUID) ([]*domain.RetentionEvent, error) {
+	return s.retentionRepo.GetEvents(ctx, fileID, userID)
+}
+
+func newEvent(actorID uuid.UUID, action, reason string) *domain.RetentionEvent {
+	return &domain.RetentionEvent{
+		ActorID:   actorID,
+		Action:    action,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+}
+
+func holdAction(hold bool) string {
+	if hold {
+		return domain.RetentionHoldPlaced
+	}
+	return domain.RetentionHoldReleased
+}
@@ -0,0 +1,291 @@
+package schedulersrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/pkg/cron"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTaskNotFound    = errors.New("scheduled task not found")
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+// Task is a maintenance task the scheduler runs. Schedule and Enabled are
+// defaults that admins can override at runtime.
+type Task struct {
+	Name        string
+	Description string
+	Schedule    string
+	Enabled     bool
+	Run         func(ctx context.Context) error
+}
+
+// SchedulerService runs registered tasks on cron schedules. Only one
+// instance should run it; the others can still serve the admin API, which
+// works through the stored task state.
+type SchedulerService struct {
+	taskRepo ports.ScheduledTaskRepository
+	location *time.Location
+	tasks    []*Task
+
+	mu      sync.Mutex
+	running map[string]bool
+	started time.Time
+}
+
+func NewSchedulerService(taskRepo ports.ScheduledTaskRepository, location *time.Location) *SchedulerService {
+	return &SchedulerService{
+		taskRepo: taskRepo,
+		location: location,
+		running:  make(map[string]bool),
+	}
+}
+
+// Register adds a task. Its default schedule must be valid.
+func (s *SchedulerService) Register(task Task) error {
+	if _, err := cron.Parse(task.Schedule); err != nil {
+		return fmt.Errorf("task %s: %w: %v", task.Name, ErrInvalidSchedule, err)
+	}
+	if s.task(task.Name) != nil {
+		return fmt.Errorf("task %s registered twice", task.Name)
+	}
+	s.tasks = append(s.tasks, &task)
+	return nil
+}
+
+func (s *SchedulerService) ListTasks(ctx context.Context) ([]*domain.ScheduledTask, error) {
+	states, err := s.taskRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task states: %w", err)
+	}
+	byName := make(map[string]*domain.TaskState, len(states))
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	tasks := make([]*domain.ScheduledTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		state := byName[task.Name]
+		if state == nil {
+			state = &domain.TaskState{Name: task.Name}
+		}
+		tasks = append(tasks, s.view(task, state))
+	}
+	return tasks, nil
+}
+
+func (s *SchedulerService) GetTask(ctx context.Context, name string) (*domain.ScheduledTask, error) {
+	task := s.task(name)
+	if task == nil {
+		return nil, ErrTaskNotFound
+	}
+	state, err := s.taskRepo.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task state: %w", err)
+	}
+	return s.view(task, state), nil
+}
+
+// UpdateTask overrides a task's schedule and/or enabled flag. Fields left
+// nil keep their current value; Reset restores the registered defaults
+// first.
+func (s *SchedulerService) UpdateTask(ctx context.Context, name string, update domain.TaskUpdate) (*domain.ScheduledTask, error) {
+	if s.task(name) == nil {
+		return nil, ErrTaskNotFound
+	}
+	if update.Schedule != nil {
+		if _, err := cron.Parse(*update.Schedule); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+
+	state := &domain.TaskState{Name: name}
+	if !update.Reset {
+		var err error
+		if state, err = s.taskRepo.Get(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to get task state: %w", err)
+		}
+	}
+	schedule, enabled := state.Schedule, state.Enabled
+	if update.Schedule != nil {
+		schedule = update.Schedule
+	}
+	if update.Enabled != nil {
+		enabled = update.Enabled
+	}
+	if err := s.taskRepo.SetConfig(ctx, name, schedule, enabled); err != nil {
+		return nil, fmt.Errorf("failed to update task: %w", err)
+	}
+	return s.GetTask(ctx, name)
+}
+
+// TriggerTask asks the scheduler to run a task as soon as possible, even if
+// it is disabled.
+func (s *SchedulerService) TriggerTask(ctx context.Context, name string) (*domain.ScheduledTask, error) {
+	if s.task(name) == nil {
+		return nil, ErrTaskNotFound
+	}
+	if err := s.taskRepo.RequestRun(ctx, name); err != nil {
+		return nil, fmt.Errorf("failed to trigger task: %w", err)
+	}
+	return s.GetTask(ctx, name)
+}
+
+// Start checks for due and triggered tasks every pollInterval until ctx is
+// cancelled, then waits for running tasks to return. A task never overlaps
+// with its own previous run.
+func (s *SchedulerService) Start(ctx context.Context, pollInterval time.Duration) {
+	log.Printf("Starting scheduler with %d tasks", len(s.tasks))
+	s.mu.Lock()
+	s.started = time.Now()
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.runDue(ctx, &wg); err != nil {
+			log.Printf("Error checking scheduled tasks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SchedulerService) runDue(ctx context.Context, wg *sync.WaitGroup) error {
+	tasks, err := s.ListTasks(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, view := range tasks {
+		due := view.Enabled && view.NextRunAt != nil && !view.NextRunAt.After(now)
+		if !due && view.RunRequestedAt == nil {
+			continue
+		}
+		task := s.task(view.Name)
+		if !s.claim(task.Name) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.release(task.Name)
+			s.run(ctx, task)
+		}()
+	}
+	return nil
+}
+
+func (s *SchedulerService) run(ctx context.Context, task *Task) {
+	startedAt := time.Now()
+	if err := s.taskRepo.MarkStarted(ctx, task.Name, startedAt); err != nil {
+		log.Printf("Error recording start of task %s: %v", task.Name, err)
+		return
+	}
+
+	status, lastError := domain.TaskStatusSucceeded, ""
+	if err := runTask(ctx, task); err != nil {
+		status, lastError = domain.TaskStatusFailed, err.Error()
+		log.Printf("Task %s failed after %s: %v", task.Name, time.Since(startedAt).Round(time.Millisecond), err)
+	} else {
+		log.Printf("Task %s finished in %s", task.Name, time.Since(startedAt).Round(time.Millisecond))
+	}
+
+	// Record the outcome even if the scheduler is stopping
+	if err := s.taskRepo.MarkFinished(context.WithoutCancel(ctx), task.Name, time.Now(), status, lastError); err != nil {
+		log.Printf("Error recording end of task %s: %v", task.Name, err)
+	}
+}
+
+// runTask turns a panicking task into a failed run.
+func runTask(ctx context.Context, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return task.Run(ctx)
+}
+
+// view merges a task's defaults with its stored state. The next run follows
+// the last start, or the scheduler start if the task never ran.
+func (s *SchedulerService) view(task *Task, state *domain.TaskState) *domain.ScheduledTask {
+	view := &domain.ScheduledTask{
+		Name:           task.Name,
+		Description:    task.Description,
+		Schedule:       task.Schedule,
+		Enabled:        task.Enabled,
+		Overridden:     state.Schedule != nil || state.Enabled != nil,
+		RunRequestedAt: state.RunRequestedAt,
+		LastStartedAt:  state.LastStartedAt,
+		LastFinishedAt: state.LastFinishedAt,
+		LastStatus:     state.LastStatus,
+		LastError:      state.LastError,
+	}
+	if state.Schedule != nil {
+		view.Schedule = *state.Schedule
+	}
+	if state.Enabled != nil {
+		view.Enabled = *state.Enabled
+	}
+
+	s.mu.Lock()
+	base := s.started
+	s.mu.Unlock()
+	if state.LastStartedAt != nil {
+		base = *state.LastStartedAt
+	}
+	if base.IsZero() {
+		base = time.Now()
+	}
+
+	if view.Enabled {
+		// An override that no longer parses falls back to the default
+		schedule, err := cron.Parse(view.Schedule)
+		if err != nil {
+			schedule, _ = cron.Parse(task.Schedule)
+		}
+		if next := schedule.Next(base.In(s.location)); !next.IsZero() {
+			view.NextRunAt = &next
+		}
+	}
+	return view
+}
+
+func (s *SchedulerService) task(name string) *Task {
+	for _, task := range s.tasks {
+		if task.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+func (s *SchedulerService) claim(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[name] {
+		return false
+	}
+	s.running[name] = true
+	return true
+}
+
+func (s *SchedulerService) release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+}
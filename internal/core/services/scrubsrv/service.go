@@ -0,0 +1,205 @@
+package scrubsrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/pkg/storage"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	batchSize = 500
+	// Blobs younger than this may belong to an upload whose row is not
+	// committed yet, so they are not reported as orphans
+	orphanGracePeriod = time.Hour
+)
+
+// ScrubService cross-checks the files table against storage: rows without a
+// blob, blobs without a row and blobs whose content no longer matches the
+// recorded checksum.
+type ScrubService struct {
+	fileRepo      ports.FileRepository
+	thumbnailRepo ports.ThumbnailRepository
+	storage       *storage.LocalStorage
+}
+
+func NewScrubService(fileRepo ports.FileRepository, thumbnailRepo ports.ThumbnailRepository, storage *storage.LocalStorage) *ScrubService {
+	return &ScrubService{
+		fileRepo:      fileRepo,
+		thumbnailRepo: thumbnailRepo,
+		storage:       storage,
+	}
+}
+
+// Run scrubs storage once and logs a summary.
+func (s *ScrubService) Run(ctx context.Context, opts domain.ScrubOptions) error {
+	report, err := s.Scrub(ctx, opts)
+	if err != nil {
+		return err
+	}
+	logReport(report)
+	return nil
+}
+
+func (s *ScrubService) Scrub(ctx context.Context, opts domain.ScrubOptions) (*domain.ScrubReport, error) {
+	report := &domain.ScrubReport{StartedAt: time.Now(), Options: opts, Issues: []domain.ScrubIssue{}}
+
+	known, err := s.checkFiles(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.addThumbnailKeys(ctx, known); err != nil {
+		return nil, err
+	}
+	if err := s.checkBlobs(report, known); err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// checkFiles verifies the blob of every row and returns the keys in use.
+func (s *ScrubService) checkFiles(ctx context.Context, report *domain.ScrubReport) (map[string]bool, error) {
+	known := make(map[string]bool)
+	after := uuid.Nil
+	for {
+		files, err := s.fileRepo.GetBatch(ctx, after, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, file := range files {
+			known[file.URL] = true
+			// The blob of an infected file is quarantined on purpose
+			if file.ScanStatus == domain.ScanStatusInfected {
+				continue
+			}
+			s.checkFile(ctx, report, file)
+		}
+		if len(files) < batchSize {
+			return known, nil
+		}
+		after = files[len(files)-1].ID
+	}
+}
+
+// addThumbnailKeys marks thumbnail blobs as in use. Missing ones are not
+// reported, since they are generated again when next requested.
+func (s *ScrubService) addThumbnailKeys(ctx context.Context, known map[string]bool) error {
+	after := ""
+	for {
+		keys, err := s.thumbnailRepo.GetKeysBatch(ctx, after, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list thumbnails: %w", err)
+		}
+		for _, key := range keys {
+			known[key] = true
+		}
+		if len(keys) < batchSize {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+func (s *ScrubService) checkFile(ctx context.Context, report *domain.ScrubReport, file *domain.File) {
+	report.FilesChecked++
+	fileID := file.ID
+	issue := domain.ScrubIssue{FileID: &fileID, Key: file.URL}
+
+	object, err := s.storage.Checksum(file.URL)
+	if err != nil {
+		issue.Kind = domain.ScrubIssueMissing
+		issue.Detail = err.Error()
+		report.Issues = append(report.Issues, issue)
+		return
+	}
+
+	switch {
+	case object.Size != file.Size:
+		issue.Kind = domain.ScrubIssueCorrupt
+		issue.Detail = fmt.Sprintf("size %d, expected %d", object.Size, file.Size)
+	case file.SHA256 == "":
+		issue.Kind = domain.ScrubIssueUnverified
+		issue.Detail = "no checksum recorded"
+		if opts := report.Options; opts.Repair {
+			if err := s.fileRepo.UpdateChecksum(ctx, file.ID, object.SHA256); err != nil {
+				issue.Action = fmt.Sprintf("checksum not recorded: %v", err)
+			} else {
+				issue.Action = "checksum recorded"
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+		return
+	case object.SHA256 != file.SHA256:
+		issue.Kind = domain.ScrubIssueCorrupt
+		issue.Detail = fmt.Sprintf("sha256 %s, expected %s", object.SHA256, file.SHA256)
+	default:
+		return
+	}
+
+	if report.Options.Quarantine {
+		issue.Action = s.quarantine(file.URL)
+	}
+	report.Issues = append(report.Issues, issue)
+}
+
+// checkBlobs reports blobs no row refers to and temp files of uploads that
+// never finished.
+func (s *ScrubService) checkBlobs(report *domain.ScrubReport, known map[string]bool) error {
+	cutoff := time.Now().Add(-orphanGracePeriod)
+	return s.storage.Walk(func(key string, info fs.FileInfo) error {
+		report.BlobsChecked++
+		if known[key] || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if storage.IsTemp(key) {
+			issue := domain.ScrubIssue{Kind: domain.ScrubIssueStaleTemp, Key: key}
+			if report.Options.Repair {
+				if err := s.storage.Delete(key); err != nil && !errors.Is(err, os.ErrNotExist) {
+					issue.Action = fmt.Sprintf("not removed: %v", err)
+				} else {
+					issue.Action = "removed"
+				}
+			}
+			report.Issues = append(report.Issues, issue)
+			return nil
+		}
+
+		issue := domain.ScrubIssue{Kind: domain.ScrubIssueOrphan, Key: key, Detail: fmt.Sprintf("%d bytes", info.Size())}
+		if report.Options.Quarantine {
+			issue.Action = s.quarantine(key)
+		}
+		report.Issues = append(report.Issues, issue)
+		return nil
+	})
+}
+
+func (s *ScrubService) quarantine(key string) string {
+	newKey, err := s.storage.Quarantine(key)
+	if err != nil {
+		return fmt.Sprintf("not quarantined: %v", err)
+	}
+	return "quarantined as " + newKey
+}
+
+func logReport(report *domain.ScrubReport) {
+	log.Printf("Storage scrub checked %d files and %d blobs in %s: %d missing, %d corrupt, %d orphaned, %d unverified, %d stale temp files",
+		report.FilesChecked, report.BlobsChecked, report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond),
+		report.Count(domain.ScrubIssueMissing), report.Count(domain.ScrubIssueCorrupt), report.Count(domain.ScrubIssueOrphan),
+		report.Count(domain.ScrubIssueUnverified), report.Count(domain.ScrubIssueStaleTemp))
+	for _, issue := range report.Issues {
+		if issue.Kind == domain.ScrubIssueMissing || issue.Kind == domain.ScrubIssueCorrupt {
+			log.Printf("Storage scrub: %s file %s at %s: %s %s", issue.Kind, issue.FileID, issue.Key, issue.Detail, issue.Action)
+		}
+	}
+}
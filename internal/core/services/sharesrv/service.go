@@ -0,0 +1,171 @@
+package sharesrv
+
+import (
+	"context"
+	"errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/ports"
+	"filesms/pkg/storage"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrShareNotFound    = errors.New("shared URL not found")
+	ErrShareExpired     = errors.New("shared URL expired")
+	ErrShareFileMissing = errors.New("shared file no longer available")
+	ErrShareNotClean    = errors.New("shared file has not passed the malware scan")
+	ErrUnauthorized     = errors.New("unauthorized access to file")
+)
+
+type ShareService struct {
+	fileRepo      ports.FileRepository
+	accessLogRepo ports.ShareAccessLogRepository
+	storage       *storage.LocalStorage
+	baseURL       string
+}
+
+// Access is the result of resolving a share token. Share and File are set as
+// far as resolution got, so denied attempts can still be attributed.
+type Access struct {
+	Share *domain.SharedFileURL
+	File  *domain.File
+	Path  string
+}
+
+func NewShareService(fileRepo ports.FileRepository, accessLogRepo ports.ShareAccessLogRepository, storage *storage.LocalStorage, baseURL string) *ShareService {
+	return &ShareService{
+		fileRepo:      fileRepo,
+		accessLogRepo: accessLogRepo,
+		storage:       storage,
+		baseURL:       baseURL,
+	}
+}
+
+func (s *ShareService) shareURL(token string) string {
+	return fmt.Sprintf("%s/share/%s", s.baseURL, token)
+}
+
+// Resolve looks up the file behind a share token.
+func (s *ShareService) Resolve(ctx context.Context, token string) (*Access, error) {
+	access := &Access{}
+	share, err := s.fileRepo.GetSharedFileURL(ctx, s.shareURL(token))
+	if err != nil {
+		return access, ErrShareNotFound
+	}
+	access.Share = share
+
+	file, err := s.fileRepo.GetByID(ctx, share.FileID)
+	if err != nil {
+		return access, ErrShareFileMissing
+	}
+	access.File = file
+
+	if time.Now().After(share.ExpiresAt) {
+		return access, ErrShareExpired
+	}
+	if file.ScanStatus != domain.ScanStatusClean {
+		return access, ErrShareNotClean
+	}
+
+	path, err := s.storage.Get(file.URL)
+	if err != nil {
+		return access, ErrShareFileMissing
+	}
+	access.Path = path
+	return access, nil
+}
+
+// RecordAccess stores one share resolution. resolveErr is the error returned
+// by Resolve (or serving), nil for a successful download.
+func (s *ShareService) RecordAccess(ctx context.Context, access *Access, ipAddress, userAgent string, bytesServed int64, resolveErr error) {
+	entry := &domain.ShareAccessLog{
+		AccessedAt:  time.Now(),
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		BytesServed: bytesServed,
+		Success:     resolveErr == nil,
+	}
+	if access.Share != nil {
+		entry.SharedFileURLID = &access.Share.ID
+		entry.FileID = &access.Share.FileID
+	}
+
+	switch {
+	case errors.Is(resolveErr, ErrShareNotFound):
+		entry.DeniedReason = domain.ShareDeniedNotFound
+	case errors.Is(resolveErr, ErrShareExpired):
+		entry.DeniedReason = domain.ShareDeniedExpired
+	case errors.Is(resolveErr, ErrShareNotClean):
+		entry.DeniedReason = domain.ShareDeniedNotClean
+	case resolveErr != nil:
+		entry.DeniedReason = domain.ShareDeniedFileMissing
+	}
+
+	if err := s.accessLogRepo.Create(ctx, entry); err != nil {
+		log.Printf("Error recording share access: %v", err)
+	}
+	// Downloads count as access for last-access lifecycle policies
+	if resolveErr == nil && access.File != nil {
+		if err := s.fileRepo.TouchAccess(ctx, access.File.ID, entry.AccessedAt); err != nil {
+			log.Printf("Error recording file access: %v", err)
+		}
+	}
+}
+
+func (s *ShareService) GetShareAccessReport(ctx context.Context, userID uuid.UUID, token string, params domain.AccessLogParams) (*domain.ShareAccessReport, error) {
+	share, err := s.fileRepo.GetSharedFileURL(ctx, s.shareURL(token))
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+	if err := s.checkOwner(ctx, userID, share.FileID); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.accessLogRepo.GetStatsBySharedFileURLID(ctx, share.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access stats: %w", err)
+	}
+	history, err := s.accessLogRepo.GetBySharedFileURLID(ctx, share.ID, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access history: %w", err)
+	}
+	return newReport(stats, history), nil
+}
+
+func (s *ShareService) GetFileAccessReport(ctx context.Context, userID uuid.UUID, fileID uuid.UUID, params domain.AccessLogParams) (*domain.ShareAccessReport, error) {
+	if err := s.checkOwner(ctx, userID, fileID); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.accessLogRepo.GetStatsByFileID(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access stats: %w", err)
+	}
+	history, err := s.accessLogRepo.GetByFileID(ctx, fileID, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access history: %w", err)
+	}
+	return newReport(stats, history), nil
+}
+
+func (s *ShareService) checkOwner(ctx context.Context, userID uuid.UUID, fileID uuid.UUID) error {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if file.UserID != userID {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func newReport(stats *domain.ShareAccessStats, history []*domain.ShareAccessLog) *domain.ShareAccessReport {
+	if history == nil {
+		history = []*domain.ShareAccessLog{}
+	}
+	return &domain.ShareAccessReport{Stats: *stats, History: history}
+}
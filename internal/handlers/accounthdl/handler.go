@@ -0,0 +1,153 @@
+package accounthdl
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/services/accountsrv"
+	"filesms/internal/core/services/authsrv"
+	"filesms/internal/core/services/filesrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/middleware"
+	"filesms/pkg/validation"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type AccountHandler struct {
+	accountService *accountsrv.AccountService
+	authService    *authsrv.AuthService
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+	Code            string `json:"code"`
+}
+
+type ChangeEmailInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code"`
+}
+
+func NewAccountHandler(accountService *accountsrv.AccountService, authService *authsrv.AuthService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+		authService:    authService,
+	}
+}
+
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(uuid.UUID)
+
+	var input ChangePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.authService.ChangePassword(r.Context(), userID, sessionID, input.CurrentPassword, input.Code, input.NewPassword); err != nil {
+		if stderrors.Is(err, authsrv.ErrReauthenticationFailed) {
+			return errors.NewAPIError(http.StatusUnauthorized, "Invalid password or two-factor code", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to change password", nil)
+	}
+	response.Success(w, "Password changed successfully, other sessions were signed out", nil)
+	return nil
+}
+
+func (h *AccountHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input ChangeEmailInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.authService.RequestEmailChange(r.Context(), userID, input.Password, input.Code, input.Email); err != nil {
+		switch {
+		case stderrors.Is(err, authsrv.ErrReauthenticationFailed):
+			return errors.NewAPIError(http.StatusUnauthorized, "Invalid password or two-factor code", nil)
+		case stderrors.Is(err, authsrv.ErrEmailInUse):
+			return errors.NewAPIError(http.StatusConflict, "Email already in use", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to change email", nil)
+	}
+	response.Success(w, "Confirmation email sent to the new address", nil)
+	return nil
+}
+
+func (h *AccountHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return errors.NewAPIError(http.StatusBadRequest, "Missing token", nil)
+	}
+
+	if err := h.authService.ConfirmEmailChange(r.Context(), token); err != nil {
+		switch {
+		case stderrors.Is(err, authsrv.ErrInvalidUserToken):
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid or expired token", nil)
+		case stderrors.Is(err, authsrv.ErrEmailInUse):
+			return errors.NewAPIError(http.StatusConflict, "Email already in use", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to change email", nil)
+	}
+	response.Success(w, "Email changed successfully", nil)
+	return nil
+}
+
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	export, err := h.accountService.GetExport(r.Context(), userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to export account", nil)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"filesms-export-%s.zip\"", export.ExportedAt.Format("20060102")))
+	// Headers are sent by now, so failures can only be logged
+	if err := h.accountService.WriteArchive(export, w); err != nil {
+		log.Printf("Error writing export of user %s: %v", userID, err)
+	}
+	return nil
+}
+
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input DeleteAccountInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.accountService.DeleteAccount(r.Context(), userID, input.Password, input.Code); err != nil {
+		if stderrors.Is(err, authsrv.ErrReauthenticationFailed) {
+			return errors.NewAPIError(http.StatusUnauthorized, "Invalid password or two-factor code", nil)
+		}
+		if stderrors.Is(err, filesrv.ErrFileLocked) {
+			return errors.NewAPIError(http.StatusLocked, "Account content is under legal hold or retention", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to delete account", nil)
+	}
+	response.Success(w, "Account deleted successfully", nil)
+	return nil
+}
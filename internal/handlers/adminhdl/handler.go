@@ -0,0 +1,213 @@
+package adminhdl
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/adminsrv"
+	"filesms/internal/core/services/filesrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/middleware"
+	"filesms/pkg/validation"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+type AdminHandler struct {
+	adminService *adminsrv.AdminService
+}
+
+type SetQuotaInput struct {
+	// Bytes is the new quota; null restores the default
+	Bytes *int64 `json:"bytes" validate:"omitempty,gte=0"`
+}
+
+type ResetPasswordInput struct {
+	Password string `json:"password" validate:"omitempty,min=6"`
+}
+
+func NewAdminHandler(adminService *adminsrv.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) error {
+	params := domain.UserSearchParams{Query: r.URL.Query().Get("query")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		params.Limit, _ = strconv.Atoi(limit)
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		params.Offset, _ = strconv.Atoi(offset)
+	}
+
+	users, err := h.adminService.SearchUsers(r.Context(), params)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get users", nil)
+	}
+	if len(users) == 0 {
+		response.Success(w, "No users found", []domain.User{})
+		return nil
+	}
+	response.Success(w, "Users retrieved successfully", users)
+	return nil
+}
+
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) error {
+	return h.setUserDisabled(w, r, true)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) error {
+	return h.setUserDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	user, err := h.adminService.SetUserDisabled(r.Context(), adminID, userID, disabled)
+	if err != nil {
+		if stderrors.Is(err, adminsrv.ErrSelfModification) {
+			return errors.NewAPIError(http.StatusBadRequest, "Admins cannot disable themselves", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to update user", nil)
+	}
+	if disabled {
+		response.Success(w, "User disabled successfully", user)
+	} else {
+		response.Success(w, "User enabled successfully", user)
+	}
+	return nil
+}
+
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	if err := h.adminService.UnlockUser(r.Context(), adminID, userID); err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to unlock user", nil)
+	}
+	response.Success(w, "User unlocked successfully", nil)
+	return nil
+}
+
+func (h *AdminHandler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	// Without a password in the body the user is emailed a reset link
+	var input ResetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.adminService.ResetUserPassword(r.Context(), adminID, userID, input.Password); err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to reset password", nil)
+	}
+	response.Success(w, "Password reset successfully", nil)
+	return nil
+}
+
+func (h *AdminHandler) GetUserFiles(w http.ResponseWriter, r *http.Request) error {
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	files, err := h.adminService.GetUserFiles(r.Context(), userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get files", nil)
+	}
+	if len(files) == 0 {
+		response.Success(w, "No files found", []domain.File{})
+		return nil
+	}
+	response.Success(w, "Files retrieved successfully", files)
+	return nil
+}
+
+func (h *AdminHandler) GetUserUsage(w http.ResponseWriter, r *http.Request) error {
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	usage, err := h.adminService.GetUserUsage(r.Context(), userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get storage usage", nil)
+	}
+	response.Success(w, "Storage usage retrieved successfully", usage)
+	return nil
+}
+
+func (h *AdminHandler) SetUserQuota(w http.ResponseWriter, r *http.Request) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	var input SetQuotaInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	user, err := h.adminService.SetUserQuota(r.Context(), adminID, userID, input.Bytes)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to set storage quota", nil)
+	}
+	response.Success(w, "Storage quota updated successfully", user)
+	return nil
+}
+
+func (h *AdminHandler) DeleteFile(w http.ResponseWriter, r *http.Request) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	fileID, err := uuid.Parse(r.URL.Query().Get("file_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid file ID", err)
+	}
+
+	if err := h.adminService.DeleteFile(r.Context(), adminID, fileID); err != nil {
+		if stderrors.Is(err, filesrv.ErrFileLocked) {
+			return errors.NewAPIError(http.StatusLocked, "File is under legal hold or retention", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to delete file", nil)
+	}
+	response.Success(w, "File deleted successfully", nil)
+	return nil
+}
+
+func (h *AdminHandler) DeleteUserFiles(w http.ResponseWriter, r *http.Request) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	count, err := h.adminService.DeleteUserFiles(r.Context(), adminID, userID)
+	if err != nil {
+		if stderrors.Is(err, filesrv.ErrFileLocked) {
+			return errors.NewAPIError(http.StatusLocked, "Files are under legal hold or retention", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to delete files", nil)
+	}
+	response.Success(w, "Files deleted successfully", map[string]int{"deleted": count})
+	return nil
+}
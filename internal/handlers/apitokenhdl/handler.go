@@ -0,0 +1,90 @@
+package apitokenhdl
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/apitokensrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/middleware"
+	"filesms/pkg/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type APITokenHandler struct {
+	tokenService *apitokensrv.APITokenService
+}
+
+type CreateTokenInput struct {
+	Name      string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes    []string `json:"scopes" validate:"required,min=1"`
+	ExpiresIn string   `json:"expires_in"`
+}
+
+func NewAPITokenHandler(tokenService *apitokensrv.APITokenService) *APITokenHandler {
+	return &APITokenHandler{tokenService: tokenService}
+}
+
+func (h *APITokenHandler) Create(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input CreateTokenInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	var expiresIn time.Duration
+	if input.ExpiresIn != "" {
+		d, err := time.ParseDuration(input.ExpiresIn)
+		if err != nil || d <= 0 {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid expires_in", nil)
+		}
+		expiresIn = d
+	}
+
+	token, err := h.tokenService.Create(r.Context(), userID, input.Name, input.Scopes, expiresIn)
+	if err != nil {
+		if stderrors.Is(err, apitokensrv.ErrInvalidScope) {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid scope", domain.APITokenScopes)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to create api token", nil)
+	}
+	response.Success(w, "API token created successfully", token)
+	return nil
+}
+
+func (h *APITokenHandler) List(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	tokens, err := h.tokenService.List(r.Context(), userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get api tokens", nil)
+	}
+	if len(tokens) == 0 {
+		response.Success(w, "No api tokens found", []domain.APIToken{})
+		return nil
+	}
+	response.Success(w, "API tokens retrieved successfully", tokens)
+	return nil
+}
+
+func (h *APITokenHandler) Revoke(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	tokenID, err := uuid.Parse(r.URL.Query().Get("token_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid token ID", err)
+	}
+
+	if err := h.tokenService.Revoke(r.Context(), userID, tokenID); err != nil {
+		return errors.NewAPIError(http.StatusNotFound, "API token not found", nil)
+	}
+	response.Success(w, "API token revoked successfully", nil)
+	return nil
+}
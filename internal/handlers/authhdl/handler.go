@@ -2,12 +2,18 @@ package authhdl
 
 import (
 	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/domain"
 	"filesms/internal/core/services/authsrv"
 	response "filesms/pkg/api"
 	"filesms/pkg/errors"
 	"filesms/pkg/middleware"
+	"filesms/pkg/netutil"
 	"filesms/pkg/validation"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -21,6 +27,37 @@ type AuthInput struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LoginChallengeInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TOTPCodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type DisableTOTPInput struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 func NewAuthHandler(authService *authsrv.AuthService) *AuthHandler {
 	return &AuthHandler{authService: authService}
 }
@@ -53,13 +90,122 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	token, err := h.authService.Login(r.Context(), input.Email, input.Password)
+	result, err := h.authService.Login(r.Context(), input.Email, input.Password, clientInfo(r))
+	if err != nil {
+		if apiErr := loginBlockedError(w, err); apiErr != nil {
+			return apiErr
+		}
+		if stderrors.Is(err, authsrv.ErrAccountDisabled) {
+			return errors.NewAPIError(http.StatusForbidden, "Account disabled", nil)
+		}
+		if stderrors.Is(err, authsrv.ErrInvalidCredentials) {
+			return errors.NewAPIError(http.StatusUnauthorized, "Invalid credentials", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to log in", nil)
+	}
+	if result.MFARequired {
+		response.Success(w, "Two-factor authentication required", result)
+		return nil
+	}
+	response.Success(w, "User logged in successfully", result)
+	return nil
+
+}
+
+// loginBlockedError answers a throttled or locked out login with 429 and a
+// Retry-After header, or returns nil for other errors.
+func loginBlockedError(w http.ResponseWriter, err error) error {
+	var blocked *authsrv.LoginBlockedError
+	if !stderrors.As(err, &blocked) {
+		return nil
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(blocked.RetryAfter.Seconds())+1))
+	if stderrors.Is(err, authsrv.ErrAccountLocked) {
+		return errors.NewAPIError(http.StatusTooManyRequests, "Account temporarily locked", nil)
+	}
+	return errors.NewAPIError(http.StatusTooManyRequests, "Too many login attempts", nil)
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) error {
+	var input RefreshInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	tokens, err := h.authService.Refresh(r.Context(), input.RefreshToken, clientInfo(r))
+	if err != nil {
+		if stderrors.Is(err, authsrv.ErrInvalidRefreshToken) {
+			return errors.NewAPIError(http.StatusUnauthorized, "Invalid refresh token", nil)
+		}
+		if stderrors.Is(err, authsrv.ErrAccountDisabled) {
+			return errors.NewAPIError(http.StatusForbidden, "Account disabled", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to refresh token", nil)
+	}
+	response.Success(w, "Token refreshed successfully", tokens)
+	return nil
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(uuid.UUID)
+	tokenID := r.Context().Value(middleware.TokenIDKey).(string)
+	expiresAt := r.Context().Value(middleware.TokenExpiresAtKey).(time.Time)
+
+	// The refresh token is optional, so an empty body is accepted
+	var input LogoutInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+
+	if err := h.authService.Logout(r.Context(), userID, sessionID, tokenID, expiresAt, input.RefreshToken); err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to log out", nil)
+	}
+	response.Success(w, "User logged out successfully", nil)
+	return nil
+}
+
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(uuid.UUID)
+
+	sessions, err := h.authService.ListSessions(r.Context(), userID, sessionID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get sessions", nil)
+	}
+	response.Success(w, "Sessions retrieved successfully", sessions)
+	return nil
+}
+
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	sessionID, err := uuid.Parse(r.URL.Query().Get("session_id"))
 	if err != nil {
-		return errors.NewAPIError(http.StatusUnauthorized, "Invalid credentials", nil)
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid session ID", err)
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		if stderrors.Is(err, authsrv.ErrSessionNotFound) {
+			return errors.NewAPIError(http.StatusNotFound, "Session not found", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to revoke session", nil)
 	}
-	response.Success(w, "User logged in successfully", token)
+	response.Success(w, "Session revoked successfully", nil)
 	return nil
+}
 
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	if err := h.authService.LogoutAll(r.Context(), userID); err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to log out all sessions", nil)
+	}
+	response.Success(w, "All sessions logged out successfully", nil)
+	return nil
 }
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) error {
 	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
@@ -72,3 +218,206 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) error {
 	response.Success(w, "User retrieved successfully", user)
 	return nil
 }
+
+func (h *AuthHandler) CompleteLogin(w http.ResponseWriter, r *http.Request) error {
+	var input LoginChallengeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	tokens, err := h.authService.CompleteLogin(r.Context(), input.ChallengeToken, input.Code, clientInfo(r))
+	if err != nil {
+		if apiErr := loginBlockedError(w, err); apiErr != nil {
+			return apiErr
+		}
+		if stderrors.Is(err, authsrv.ErrInvalidTOTPCode) {
+			return errors.NewAPIError(http.StatusUnauthorized, "Invalid two-factor code", nil)
+		}
+		if stderrors.Is(err, authsrv.ErrAccountDisabled) {
+			return errors.NewAPIError(http.StatusForbidden, "Account disabled", nil)
+		}
+		return errors.NewAPIError(http.StatusUnauthorized, "Invalid or expired login challenge", nil)
+	}
+	response.Success(w, "User logged in successfully", tokens)
+	return nil
+}
+
+func (h *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	enrollment, err := h.authService.EnrollTOTP(r.Context(), userID)
+	if err != nil {
+		return totpError(err, "Failed to enroll two-factor authentication")
+	}
+	response.Success(w, "Two-factor enrollment started, confirm with a code", enrollment)
+	return nil
+}
+
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input TOTPCodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	codes, err := h.authService.ConfirmTOTP(r.Context(), userID, input.Code)
+	if err != nil {
+		return totpError(err, "Failed to enable two-factor authentication")
+	}
+	response.Success(w, "Two-factor authentication enabled, store these recovery codes", codes)
+	return nil
+}
+
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input DisableTOTPInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.authService.DisableTOTP(r.Context(), userID, input.Password, input.Code); err != nil {
+		return totpError(err, "Failed to disable two-factor authentication")
+	}
+	response.Success(w, "Two-factor authentication disabled", nil)
+	return nil
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input TOTPCodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(r.Context(), userID, input.Code)
+	if err != nil {
+		return totpError(err, "Failed to regenerate recovery codes")
+	}
+	response.Success(w, "Recovery codes regenerated", codes)
+	return nil
+}
+
+func totpError(err error, fallback string) error {
+	switch {
+	case stderrors.Is(err, authsrv.ErrTOTPAlreadyEnabled):
+		return errors.NewAPIError(http.StatusConflict, "Two-factor authentication already enabled", nil)
+	case stderrors.Is(err, authsrv.ErrTOTPNotEnrolled):
+		return errors.NewAPIError(http.StatusBadRequest, "Two-factor authentication not enrolled", nil)
+	case stderrors.Is(err, authsrv.ErrInvalidTOTPCode):
+		return errors.NewAPIError(http.StatusUnauthorized, "Invalid two-factor code", nil)
+	}
+	return errors.NewAPIError(http.StatusInternalServerError, fallback, nil)
+}
+
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return errors.NewAPIError(http.StatusBadRequest, "Missing token", nil)
+	}
+
+	if err := h.authService.VerifyEmail(r.Context(), token); err != nil {
+		if stderrors.Is(err, authsrv.ErrInvalidUserToken) {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid or expired token", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to verify email", nil)
+	}
+	response.Success(w, "Email verified successfully", nil)
+	return nil
+}
+
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return errors.NewAPIError(http.StatusBadRequest, "Missing token", nil)
+	}
+
+	if err := h.authService.UnlockAccountWithToken(r.Context(), token); err != nil {
+		if stderrors.Is(err, authsrv.ErrInvalidUserToken) {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid or expired token", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to unlock account", nil)
+	}
+	response.Success(w, "Account unlocked successfully", nil)
+	return nil
+}
+
+func (h *AuthHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	if err := h.authService.ResendVerificationEmail(r.Context(), userID); err != nil {
+		if stderrors.Is(err, authsrv.ErrEmailAlreadyVerified) {
+			return errors.NewAPIError(http.StatusConflict, "Email already verified", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to send verification email", nil)
+	}
+	response.Success(w, "Verification email sent", nil)
+	return nil
+}
+
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	var input ForgotPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.authService.RequestPasswordReset(r.Context(), input.Email); err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to request password reset", nil)
+	}
+	response.Success(w, "If the account exists, a password reset email has been sent", nil)
+	return nil
+}
+
+// ResetPassword sets a new password from a JSON body. A GET, as from the
+// link in the reset email, serves a page that asks for the password.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodGet {
+		return serveResetPasswordPage(w, r)
+	}
+	var input ResetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	if err := h.authService.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+		if stderrors.Is(err, authsrv.ErrInvalidUserToken) {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid or expired token", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to reset password", nil)
+	}
+	response.Success(w, "Password reset successfully", nil)
+	return nil
+}
+
+// JWKS serves the token verification keys in the standard JWK Set format
+// rather than the usual response envelope, so generic JWT libraries can use it.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
+func clientInfo(r *http.Request) domain.ClientInfo {
+	return domain.ClientInfo{IPAddress: netutil.ClientIP(r), UserAgent: r.UserAgent()}
+}
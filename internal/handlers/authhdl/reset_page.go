@@ -0,0 +1,53 @@
+package authhdl
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// resetPasswordPage is where the link in password reset emails lands. It
+// posts the token and the new password to the JSON endpoint.
+var resetPasswordPage = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Reset your password</title>
+</head>
+<body>
+<h1>Reset your password</h1>
+<form id="reset">
+<label>New password <input type="password" name="password" minlength="6" required autocomplete="new-password"></label>
+<button type="submit">Reset password</button>
+</form>
+<p id="result"></p>
+<script>
+const token = {{.Token}};
+document.getElementById("reset").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const password = event.target.password.value;
+  const result = document.getElementById("result");
+  try {
+    const res = await fetch(window.location.pathname, {
+      method: "POST",
+      headers: {"Content-Type": "application/json"},
+      body: JSON.stringify({token: token, password: password}),
+    });
+    const body = await res.json();
+    result.textContent = body.message || (res.ok ? "Password reset successfully" : "Failed to reset password");
+    if (res.ok) event.target.hidden = true;
+  } catch (err) {
+    result.textContent = "Failed to reset password";
+  }
+});
+</script>
+</body>
+</html>
+`))
+
+func serveResetPasswordPage(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	return resetPasswordPage.Execute(w, struct{ Token string }{r.URL.Query().Get("token")})
+}
@@ -1,12 +1,17 @@
 package filehdl
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
 	"filesms/internal/core/domain"
 	"filesms/internal/core/services/filesrv"
 	response "filesms/pkg/api"
 	"filesms/pkg/errors"
 	"filesms/pkg/middleware"
+	"filesms/pkg/validation"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -17,6 +22,16 @@ type FileHandler struct {
 	fileService *filesrv.FileService
 }
 
+type PresignUploadInput struct {
+	Name        string `json:"name" validate:"required,min=1,max=255"`
+	Size        int64  `json:"size" validate:"required,gt=0"`
+	ContentType string `json:"content_type" validate:"required,min=1,max=255"`
+	SHA256      string `json:"sha256" validate:"omitempty,len=64,hexadecimal"`
+	ExpiresIn   string `json:"expires_in"`
+	// Retention overrides the lifecycle policies for the uploaded file
+	Retention string `json:"retention"`
+}
+
 func NewFileHandler(fileService *filesrv.FileService) *FileHandler {
 	return &FileHandler{fileService: fileService}
 }
@@ -24,14 +39,37 @@ func NewFileHandler(fileService *filesrv.FileService) *FileHandler {
 func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) error {
 	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
 
+	// Leave room for the multipart framing around the file. A maximum of 0
+	// means uploads are unlimited.
+	if maxSize := h.fileService.MaxUploadSize(); maxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	}
 	file, header, err := r.FormFile("file")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			return errors.NewAPIError(http.StatusRequestEntityTooLarge, "File exceeds the maximum upload size", nil)
+		}
 		return errors.NewAPIError(http.StatusBadRequest, "Failed to read file", nil)
 	}
 	defer file.Close()
 
-	uploadedFile, err := h.fileService.Upload(r.Context(), userID, header.Filename, file, header.Size)
+	// An optional hex SHA-256 lets the client detect corruption in transit
+	expectedSHA256 := r.FormValue("sha256")
+	if expectedSHA256 != "" && !validSHA256(expectedSHA256) {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid sha256", nil)
+	}
+
+	retention, err := parseRetention(r.FormValue("retention"))
 	if err != nil {
+		return err
+	}
+
+	uploadedFile, err := h.fileService.Upload(r.Context(), userID, header.Filename, file, header.Size, expectedSHA256, retention)
+	if err != nil {
+		if apiErr := uploadError(err); apiErr != nil {
+			return apiErr
+		}
 		return errors.NewAPIError(http.StatusInternalServerError, "Failed to upload file", nil)
 	}
 	response.Success(w, "File uploaded successfully", uploadedFile)
@@ -69,6 +107,9 @@ func (h *FileHandler) ShareFile(w http.ResponseWriter, r *http.Request) error {
 
 	shareURL, err := h.fileService.ShareFile(r.Context(), fileID, userID, expirationTime)
 	if err != nil {
+		if stderrors.Is(err, filesrv.ErrFileNotClean) {
+			return errors.NewAPIError(http.StatusConflict, "File cannot be shared until it passes a malware scan", nil)
+		}
 		return errors.NewAPIError(http.StatusInternalServerError, "Failed to share file", err)
 	}
 	response.Success(w, "File shared successfully", shareURL)
@@ -131,6 +172,171 @@ func (h *FileHandler) GetFile(w http.ResponseWriter, r *http.Request) error {
 	if userId != file.UserID {
 		return errors.NewAPIError(http.StatusUnauthorized, "Unauthorized access to file", nil)
 	}
+	h.fileService.RecordAccess(r.Context(), file.ID)
 	response.Success(w, "File retrieved successfully", file)
 	return nil
 }
+
+// Thumbnail serves a scaled-down preview of an image file. The size is
+// small, medium or large.
+func (h *FileHandler) Thumbnail(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	fileID, err := uuid.Parse(r.URL.Query().Get("file_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid file ID", err)
+	}
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = "medium"
+	}
+
+	thumb, path, err := h.fileService.GetThumbnail(r.Context(), userID, fileID, size)
+	if err != nil {
+		switch {
+		case stderrors.Is(err, filesrv.ErrThumbnailSize):
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid thumbnail size", nil)
+		case stderrors.Is(err, filesrv.ErrUnauthorized):
+			return errors.NewAPIError(http.StatusUnauthorized, "Unauthorized access to file", nil)
+		case stderrors.Is(err, filesrv.ErrFileNotClean):
+			return errors.NewAPIError(http.StatusConflict, "File has no thumbnail until it passes a malware scan", nil)
+		case stderrors.Is(err, filesrv.ErrNoThumbnail):
+			return errors.NewAPIError(http.StatusUnprocessableEntity, "No thumbnail is available for this file", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get thumbnail", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get thumbnail", err)
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", thumb.MIMEType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", thumb.CreatedAt, f)
+	return nil
+}
+
+func (h *FileHandler) PresignUpload(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	var input PresignUploadInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	var expiresIn time.Duration
+	if input.ExpiresIn != "" {
+		d, err := time.ParseDuration(input.ExpiresIn)
+		if err != nil {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid expires_in", nil)
+		}
+		expiresIn = d
+	}
+
+	retention, err := parseRetention(input.Retention)
+	if err != nil {
+		return err
+	}
+
+	upload, err := h.fileService.PresignUpload(r.Context(), userID, input.Name, input.Size, input.ContentType, input.SHA256, retention, expiresIn)
+	if err != nil {
+		if apiErr := uploadError(err); apiErr != nil {
+			return apiErr
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to create upload url", nil)
+	}
+	response.Success(w, "Upload url created successfully", upload)
+	return nil
+}
+
+// DirectUpload accepts the bytes for a presigned upload. It is authorized by
+// the URL signature rather than a bearer token.
+func (h *FileHandler) DirectUpload(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPut {
+		return errors.NewAPIError(http.StatusMethodNotAllowed, "Method not allowed", nil)
+	}
+	defer r.Body.Close()
+
+	size, err := strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
+	if err != nil {
+		return errors.NewAPIError(http.StatusForbidden, "Invalid or expired upload url", nil)
+	}
+	if r.ContentLength > size {
+		return errors.NewAPIError(http.StatusRequestEntityTooLarge, "Content exceeds declared size", nil)
+	}
+	body := http.MaxBytesReader(w, r.Body, size+1)
+
+	file, err := h.fileService.CompleteDirectUpload(r.Context(), r.URL.Query(), r.Header.Get("Content-Type"), body)
+	if err != nil {
+		switch {
+		case stderrors.Is(err, filesrv.ErrUploadURLInvalid):
+			return errors.NewAPIError(http.StatusForbidden, "Invalid or expired upload url", nil)
+		case stderrors.Is(err, filesrv.ErrUploadURLUsed):
+			return errors.NewAPIError(http.StatusConflict, "Upload url already used", nil)
+		case stderrors.Is(err, filesrv.ErrAccountDisabled):
+			return errors.NewAPIError(http.StatusForbidden, "Account disabled", nil)
+		case stderrors.Is(err, filesrv.ErrUploadSizeInvalid):
+			return errors.NewAPIError(http.StatusBadRequest, "Content does not match declared size", nil)
+		}
+		if apiErr := uploadError(err); apiErr != nil {
+			return apiErr
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to upload file", nil)
+	}
+	response.Success(w, "File uploaded successfully", file)
+	return nil
+}
+
+func (h *FileHandler) GetUsage(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	usage, err := h.fileService.GetUsage(r.Context(), userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get storage usage", nil)
+	}
+	response.Success(w, "Storage usage retrieved successfully", usage)
+	return nil
+}
+
+// uploadError maps quota and upload policy failures to API errors, or returns
+// nil for other errors.
+func uploadError(err error) error {
+	switch {
+	case stderrors.Is(err, filesrv.ErrUploadTooLarge):
+		return errors.NewAPIError(http.StatusRequestEntityTooLarge, "File exceeds the maximum upload size", nil)
+	case stderrors.Is(err, filesrv.ErrFileTypeNotAllowed):
+		return errors.NewAPIError(http.StatusUnsupportedMediaType, "File type not allowed", nil)
+	case stderrors.Is(err, filesrv.ErrContentMismatch):
+		return errors.NewAPIError(http.StatusUnsupportedMediaType, "File content does not match its extension", nil)
+	case stderrors.Is(err, filesrv.ErrChecksumMismatch):
+		return errors.NewAPIError(http.StatusUnprocessableEntity, "File content does not match the expected sha256", nil)
+	case stderrors.Is(err, filesrv.ErrFileTooLarge):
+		return errors.NewAPIError(http.StatusRequestEntityTooLarge, "File is larger than your storage quota", nil)
+	case stderrors.Is(err, filesrv.ErrQuotaExceeded):
+		return errors.NewAPIError(http.StatusInsufficientStorage, "Storage quota exceeded", nil)
+	}
+	return nil
+}
+
+func validSHA256(digest string) bool {
+	if len(digest) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// parseRetention reads an optional per-upload retention override.
+func parseRetention(raw string) (*domain.Retention, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	retention, err := domain.ParseRetention(raw)
+	if err != nil {
+		return nil, errors.NewAPIError(http.StatusBadRequest, "Invalid retention", err.Error())
+	}
+	return retention, nil
+}
@@ -0,0 +1,70 @@
+package jobhdl
+
+import (
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/jobsrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type JobHandler struct {
+	jobService *jobsrv.JobService
+}
+
+func NewJobHandler(jobService *jobsrv.JobService) *JobHandler {
+	return &JobHandler{jobService: jobService}
+}
+
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) error {
+	params := domain.JobSearchParams{
+		Status: r.URL.Query().Get("status"),
+		Type:   r.URL.Query().Get("type"),
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		params.Limit, _ = strconv.Atoi(limit)
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		params.Offset, _ = strconv.Atoi(offset)
+	}
+
+	jobs, err := h.jobService.SearchJobs(r.Context(), params)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get jobs", nil)
+	}
+	if len(jobs) == 0 {
+		response.Success(w, "No jobs found", []domain.Job{})
+		return nil
+	}
+	response.Success(w, "Jobs retrieved successfully", jobs)
+	return nil
+}
+
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) error {
+	jobID, err := strconv.ParseInt(r.URL.Query().Get("job_id"), 10, 64)
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid job ID", err)
+	}
+
+	job, err := h.jobService.GetJob(r.Context(), jobID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusNotFound, "Job not found", nil)
+	}
+	response.Success(w, "Job retrieved successfully", job)
+	return nil
+}
+
+// RetryJob requeues a dead job with its attempts reset.
+func (h *JobHandler) RetryJob(w http.ResponseWriter, r *http.Request) error {
+	jobID, err := strconv.ParseInt(r.URL.Query().Get("job_id"), 10, 64)
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid job ID", err)
+	}
+
+	if err := h.jobService.RetryJob(r.Context(), jobID); err != nil {
+		return errors.NewAPIError(http.StatusNotFound, "Dead job not found", nil)
+	}
+	response.Success(w, "Job requeued successfully", nil)
+	return nil
+}
@@ -0,0 +1,151 @@
+package lifecyclehdl
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/lifecyclesrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/middleware"
+	"filesms/pkg/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultPreviewWindow = 7 * 24 * time.Hour
+
+type LifecycleHandler struct {
+	lifecycleService *lifecyclesrv.LifecycleService
+}
+
+type CreatePolicyInput struct {
+	FileType string `json:"file_type" validate:"max=100"`
+	Action   string `json:"action" validate:"required,oneof=expire never_expire cold_tier"`
+	Days     int    `json:"days" validate:"gte=0"`
+	Basis    string `json:"basis" validate:"omitempty,oneof=created last_access"`
+}
+
+func NewLifecycleHandler(lifecycleService *lifecyclesrv.LifecycleService) *LifecycleHandler {
+	return &LifecycleHandler{lifecycleService: lifecycleService}
+}
+
+// The user endpoints manage the caller's own policies; the Global variants
+// are for admins and manage the policies that apply to everyone.
+
+func (h *LifecycleHandler) ListPolicies(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	return h.listPolicies(w, r, &userID)
+}
+
+func (h *LifecycleHandler) ListGlobalPolicies(w http.ResponseWriter, r *http.Request) error {
+	return h.listPolicies(w, r, nil)
+}
+
+func (h *LifecycleHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	return h.createPolicy(w, r, &userID)
+}
+
+func (h *LifecycleHandler) CreateGlobalPolicy(w http.ResponseWriter, r *http.Request) error {
+	return h.createPolicy(w, r, nil)
+}
+
+func (h *LifecycleHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	return h.deletePolicy(w, r, &userID)
+}
+
+func (h *LifecycleHandler) DeleteGlobalPolicy(w http.ResponseWriter, r *http.Request) error {
+	return h.deletePolicy(w, r, nil)
+}
+
+// Preview is a dry run of lifecycle processing for the caller's files.
+func (h *LifecycleHandler) Preview(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	return h.preview(w, r, &userID)
+}
+
+// AdminPreview is a dry run for every file, or one user's with user_id.
+func (h *LifecycleHandler) AdminPreview(w http.ResponseWriter, r *http.Request) error {
+	var userID *uuid.UUID
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+		}
+		userID = &id
+	}
+	return h.preview(w, r, userID)
+}
+
+func (h *LifecycleHandler) listPolicies(w http.ResponseWriter, r *http.Request, userID *uuid.UUID) error {
+	policies, err := h.lifecycleService.ListPolicies(r.Context(), userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get lifecycle policies", nil)
+	}
+	if len(policies) == 0 {
+		response.Success(w, "No lifecycle policies found", []domain.LifecyclePolicy{})
+		return nil
+	}
+	response.Success(w, "Lifecycle policies retrieved successfully", policies)
+	return nil
+}
+
+func (h *LifecycleHandler) createPolicy(w http.ResponseWriter, r *http.Request, userID *uuid.UUID) error {
+	var input CreatePolicyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	policy := &domain.LifecyclePolicy{
+		FileType: input.FileType,
+		Action:   input.Action,
+		Days:     input.Days,
+		Basis:    input.Basis,
+	}
+	if err := h.lifecycleService.CreatePolicy(r.Context(), userID, policy); err != nil {
+		if stderrors.Is(err, lifecyclesrv.ErrInvalidPolicy) {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid lifecycle policy", err.Error())
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to create lifecycle policy", nil)
+	}
+	response.Success(w, "Lifecycle policy created successfully", policy)
+	return nil
+}
+
+func (h *LifecycleHandler) deletePolicy(w http.ResponseWriter, r *http.Request, userID *uuid.UUID) error {
+	policyID, err := uuid.Parse(r.URL.Query().Get("policy_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid policy ID", err)
+	}
+
+	if err := h.lifecycleService.DeletePolicy(r.Context(), policyID, userID); err != nil {
+		return errors.NewAPIError(http.StatusNotFound, "Lifecycle policy not found", nil)
+	}
+	response.Success(w, "Lifecycle policy deleted successfully", nil)
+	return nil
+}
+
+func (h *LifecycleHandler) preview(w http.ResponseWriter, r *http.Request, userID *uuid.UUID) error {
+	within := defaultPreviewWindow
+	if raw := r.URL.Query().Get("within"); raw != "" {
+		window, err := domain.ParseRetention(raw)
+		if err != nil || window.Never {
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid within", nil)
+		}
+		within = window.Duration
+	}
+
+	report, err := h.lifecycleService.Preview(r.Context(), userID, within)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to preview lifecycle", nil)
+	}
+	response.Success(w, "Lifecycle preview generated successfully", report)
+	return nil
+}
@@ -0,0 +1,70 @@
+package oidchdl
+
+import (
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/authsrv"
+	"filesms/internal/core/services/oidcsrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/netutil"
+	"net/http"
+)
+
+type OIDCHandler struct {
+	oidcService *oidcsrv.OIDCService
+}
+
+func NewOIDCHandler(oidcService *oidcsrv.OIDCService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService}
+}
+
+func (h *OIDCHandler) Providers(w http.ResponseWriter, r *http.Request) error {
+	response.Success(w, "Identity providers retrieved successfully", h.oidcService.Providers())
+	return nil
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) error {
+	authURL, err := h.oidcService.BeginLogin(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil {
+		if stderrors.Is(err, oidcsrv.ErrUnknownProvider) {
+			return errors.NewAPIError(http.StatusNotFound, "Unknown identity provider", nil)
+		}
+		return errors.NewAPIError(http.StatusBadGateway, "Failed to start single sign-on", nil)
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+	return nil
+}
+
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	if idpErr := query.Get("error"); idpErr != "" {
+		return errors.NewAPIError(http.StatusUnauthorized, "Single sign-on was denied", idpErr)
+	}
+	if query.Get("state") == "" || query.Get("code") == "" {
+		return errors.NewAPIError(http.StatusBadRequest, "Missing state or code", nil)
+	}
+
+	client := domain.ClientInfo{IPAddress: netutil.ClientIP(r), UserAgent: r.UserAgent()}
+	result, err := h.oidcService.CompleteLogin(r.Context(), query.Get("state"), query.Get("code"), client)
+	if err != nil {
+		switch {
+		case stderrors.Is(err, oidcsrv.ErrInvalidState):
+			return errors.NewAPIError(http.StatusBadRequest, "Invalid or expired login state", nil)
+		case stderrors.Is(err, oidcsrv.ErrEmailNotVerified):
+			return errors.NewAPIError(http.StatusForbidden, "Identity provider did not verify the email address", nil)
+		case stderrors.Is(err, oidcsrv.ErrAccountUnverified):
+			return errors.NewAPIError(http.StatusConflict, "An account with this email exists but is not verified; reset its password to verify it, then sign in again", nil)
+		case stderrors.Is(err, authsrv.ErrAccountDisabled):
+			return errors.NewAPIError(http.StatusForbidden, "Account disabled", nil)
+		}
+		return errors.NewAPIError(http.StatusUnauthorized, "Single sign-on failed", nil)
+	}
+	if result.MFARequired {
+		response.Success(w, "Two-factor authentication required", result)
+		return nil
+	}
+	response.Success(w, "User logged in successfully", result)
+	return nil
+}
@@ -0,0 +1,161 @@
+package retentionhdl
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/retentionsrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/middleware"
+	"filesms/pkg/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RetentionHandler struct {
+	retentionService *retentionsrv.RetentionService
+}
+
+type HoldInput struct {
+	Reason string `json:"reason" validate:"required,min=1,max=1000"`
+}
+
+type RetentionInput struct {
+	RetainUntil time.Time `json:"retain_until" validate:"required"`
+	Reason      string    `json:"reason" validate:"required,min=1,max=1000"`
+}
+
+func NewRetentionHandler(retentionService *retentionsrv.RetentionService) *RetentionHandler {
+	return &RetentionHandler{retentionService: retentionService}
+}
+
+func (h *RetentionHandler) HoldFile(w http.ResponseWriter, r *http.Request) error {
+	return h.setFileHold(w, r, true)
+}
+
+func (h *RetentionHandler) ReleaseFile(w http.ResponseWriter, r *http.Request) error {
+	return h.setFileHold(w, r, false)
+}
+
+func (h *RetentionHandler) HoldUser(w http.ResponseWriter, r *http.Request) error {
+	return h.setUserHold(w, r, true)
+}
+
+func (h *RetentionHandler) ReleaseUser(w http.ResponseWriter, r *http.Request) error {
+	return h.setUserHold(w, r, false)
+}
+
+func (h *RetentionHandler) setFileHold(w http.ResponseWriter, r *http.Request, hold bool) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	fileID, err := uuid.Parse(r.URL.Query().Get("file_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid file ID", err)
+	}
+	var input HoldInput
+	if err := decode(r, &input); err != nil {
+		return err
+	}
+
+	event, err := h.retentionService.SetFileLegalHold(r.Context(), adminID, fileID, hold, input.Reason)
+	if err != nil {
+		if stderrors.Is(err, domain.ErrFileNotFound) {
+			return errors.NewAPIError(http.StatusNotFound, "File not found", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to update legal hold", err)
+	}
+	response.Success(w, "Legal hold updated successfully", event)
+	return nil
+}
+
+func (h *RetentionHandler) setUserHold(w http.ResponseWriter, r *http.Request, hold bool) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	userID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+	var input HoldInput
+	if err := decode(r, &input); err != nil {
+		return err
+	}
+
+	event, err := h.retentionService.SetUserLegalHold(r.Context(), adminID, userID, hold, input.Reason)
+	if err != nil {
+		if stderrors.Is(err, domain.ErrUserNotFound) {
+			return errors.NewAPIError(http.StatusNotFound, "User not found", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to update legal hold", err)
+	}
+	response.Success(w, "Legal hold updated successfully", event)
+	return nil
+}
+
+func (h *RetentionHandler) ExtendRetention(w http.ResponseWriter, r *http.Request) error {
+	adminID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	fileID, err := uuid.Parse(r.URL.Query().Get("file_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid file ID", err)
+	}
+	var input RetentionInput
+	if err := decode(r, &input); err != nil {
+		return err
+	}
+
+	event, err := h.retentionService.ExtendRetention(r.Context(), adminID, fileID, input.RetainUntil, input.Reason)
+	if err != nil {
+		switch {
+		case stderrors.Is(err, retentionsrv.ErrRetentionInPast):
+			return errors.NewAPIError(http.StatusBadRequest, "Retention date must be in the future", nil)
+		case stderrors.Is(err, retentionsrv.ErrRetentionShortened):
+			return errors.NewAPIError(http.StatusConflict, "Retention can only be extended", nil)
+		case stderrors.Is(err, domain.ErrFileNotFound):
+			return errors.NewAPIError(http.StatusNotFound, "File not found", nil)
+		}
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to extend retention", err)
+	}
+	response.Success(w, "Retention extended successfully", event)
+	return nil
+}
+
+// Events returns the audit trail, filtered by file_id and/or user_id.
+func (h *RetentionHandler) Events(w http.ResponseWriter, r *http.Request) error {
+	fileID, err := optionalUUID(r.URL.Query().Get("file_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid file ID", err)
+	}
+	userID, err := optionalUUID(r.URL.Query().Get("user_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	events, err := h.retentionService.GetEvents(r.Context(), fileID, userID)
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get retention events", nil)
+	}
+	if len(events) == 0 {
+		response.Success(w, "No retention events found", []domain.RetentionEvent{})
+		return nil
+	}
+	response.Success(w, "Retention events retrieved successfully", events)
+	return nil
+}
+
+func decode(r *http.Request, input interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	return validation.ValidateStruct(input)
+}
+
+func optionalUUID(raw string) (*uuid.UUID, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
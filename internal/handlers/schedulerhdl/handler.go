@@ -0,0 +1,91 @@
+package schedulerhdl
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/schedulersrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/validation"
+	"net/http"
+)
+
+type SchedulerHandler struct {
+	schedulerService *schedulersrv.SchedulerService
+}
+
+type UpdateTaskInput struct {
+	// Schedule is a cron expression, e.g. "0 3 * * *" or "@every 10m"
+	Schedule *string `json:"schedule" validate:"omitempty,min=1,max=255"`
+	Enabled  *bool   `json:"enabled"`
+	// Reset restores the configured defaults before applying the other fields
+	Reset bool `json:"reset"`
+}
+
+func NewSchedulerHandler(schedulerService *schedulersrv.SchedulerService) *SchedulerHandler {
+	return &SchedulerHandler{schedulerService: schedulerService}
+}
+
+func (h *SchedulerHandler) ListTasks(w http.ResponseWriter, r *http.Request) error {
+	tasks, err := h.schedulerService.ListTasks(r.Context())
+	if err != nil {
+		return errors.NewAPIError(http.StatusInternalServerError, "Failed to get scheduled tasks", nil)
+	}
+	if len(tasks) == 0 {
+		response.Success(w, "No scheduled tasks found", []domain.ScheduledTask{})
+		return nil
+	}
+	response.Success(w, "Scheduled tasks retrieved successfully", tasks)
+	return nil
+}
+
+func (h *SchedulerHandler) GetTask(w http.ResponseWriter, r *http.Request) error {
+	task, err := h.schedulerService.GetTask(r.Context(), r.URL.Query().Get("name"))
+	if err != nil {
+		return taskError(err, "Failed to get scheduled task")
+	}
+	response.Success(w, "Scheduled task retrieved successfully", task)
+	return nil
+}
+
+func (h *SchedulerHandler) UpdateTask(w http.ResponseWriter, r *http.Request) error {
+	var input UpdateTaskInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid JSON", nil)
+	}
+	if err := validation.ValidateStruct(input); err != nil {
+		return err
+	}
+
+	task, err := h.schedulerService.UpdateTask(r.Context(), r.URL.Query().Get("name"), domain.TaskUpdate{
+		Schedule: input.Schedule,
+		Enabled:  input.Enabled,
+		Reset:    input.Reset,
+	})
+	if err != nil {
+		return taskError(err, "Failed to update scheduled task")
+	}
+	response.Success(w, "Scheduled task updated successfully", task)
+	return nil
+}
+
+// RunTask queues a run of the task on the instance running the scheduler.
+func (h *SchedulerHandler) RunTask(w http.ResponseWriter, r *http.Request) error {
+	task, err := h.schedulerService.TriggerTask(r.Context(), r.URL.Query().Get("name"))
+	if err != nil {
+		return taskError(err, "Failed to trigger scheduled task")
+	}
+	response.Success(w, "Scheduled task triggered successfully", task)
+	return nil
+}
+
+func taskError(err error, message string) error {
+	switch {
+	case stderrors.Is(err, schedulersrv.ErrTaskNotFound):
+		return errors.NewAPIError(http.StatusNotFound, "Scheduled task not found", nil)
+	case stderrors.Is(err, schedulersrv.ErrInvalidSchedule):
+		return errors.NewAPIError(http.StatusBadRequest, err.Error(), nil)
+	}
+	return errors.NewAPIError(http.StatusInternalServerError, message, nil)
+}
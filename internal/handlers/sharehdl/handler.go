@@ -0,0 +1,127 @@
+package sharehdl
+
+import (
+	stderrors "errors"
+	"filesms/internal/core/domain"
+	"filesms/internal/core/services/sharesrv"
+	response "filesms/pkg/api"
+	"filesms/pkg/errors"
+	"filesms/pkg/middleware"
+	"filesms/pkg/netutil"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type ShareHandler struct {
+	shareService *sharesrv.ShareService
+}
+
+func NewShareHandler(shareService *sharesrv.ShareService) *ShareHandler {
+	return &ShareHandler{shareService: shareService}
+}
+
+// Download serves a shared file to anyone holding the link and records the
+// attempt in the access log.
+func (h *ShareHandler) Download(w http.ResponseWriter, r *http.Request) error {
+	token := strings.TrimPrefix(r.URL.Path, "/files/share/")
+	ip := netutil.ClientIP(r)
+	userAgent := r.UserAgent()
+
+	access, err := h.shareService.Resolve(r.Context(), token)
+	if err != nil {
+		h.shareService.RecordAccess(r.Context(), access, ip, userAgent, 0, err)
+		switch {
+		case stderrors.Is(err, sharesrv.ErrShareExpired):
+			return errors.NewAPIError(http.StatusGone, "Shared link expired", nil)
+		case stderrors.Is(err, sharesrv.ErrShareNotClean):
+			return errors.NewAPIError(http.StatusForbidden, "Shared file is not available until it passes a malware scan", nil)
+		}
+		return errors.NewAPIError(http.StatusNotFound, "Shared file not found", nil)
+	}
+
+	f, err := os.Open(access.Path)
+	if err != nil {
+		h.shareService.RecordAccess(r.Context(), access, ip, userAgent, 0, sharesrv.ErrShareFileMissing)
+		return errors.NewAPIError(http.StatusNotFound, "Shared file not found", nil)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		h.shareService.RecordAccess(r.Context(), access, ip, userAgent, 0, sharesrv.ErrShareFileMissing)
+		return errors.NewAPIError(http.StatusNotFound, "Shared file not found", nil)
+	}
+
+	cw := &countingWriter{ResponseWriter: w}
+	cw.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": access.File.Name}))
+	http.ServeContent(cw, r, access.File.Name, stat.ModTime(), f)
+	h.shareService.RecordAccess(r.Context(), access, ip, userAgent, cw.written, nil)
+	return nil
+}
+
+func (h *ShareHandler) ShareAccessLog(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return errors.NewAPIError(http.StatusBadRequest, "Missing share token", nil)
+	}
+
+	report, err := h.shareService.GetShareAccessReport(r.Context(), userID, token, accessLogParams(r))
+	if err != nil {
+		return accessReportError(err)
+	}
+	response.Success(w, "Share access log retrieved successfully", report)
+	return nil
+}
+
+func (h *ShareHandler) FileAccessLog(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	fileID, err := uuid.Parse(r.URL.Query().Get("file_id"))
+	if err != nil {
+		return errors.NewAPIError(http.StatusBadRequest, "Invalid file ID", err)
+	}
+
+	report, err := h.shareService.GetFileAccessReport(r.Context(), userID, fileID, accessLogParams(r))
+	if err != nil {
+		return accessReportError(err)
+	}
+	response.Success(w, "File access log retrieved successfully", report)
+	return nil
+}
+
+// accessLogParams reads the limit and offset of the access history page.
+func accessLogParams(r *http.Request) domain.AccessLogParams {
+	var params domain.AccessLogParams
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		params.Limit, _ = strconv.Atoi(limit)
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		params.Offset, _ = strconv.Atoi(offset)
+	}
+	return params
+}
+
+func accessReportError(err error) error {
+	switch {
+	case stderrors.Is(err, sharesrv.ErrUnauthorized):
+		return errors.NewAPIError(http.StatusUnauthorized, "Unauthorized access to file", nil)
+	case stderrors.Is(err, sharesrv.ErrShareNotFound):
+		return errors.NewAPIError(http.StatusNotFound, "Shared link not found", nil)
+	}
+	return errors.NewAPIError(http.StatusInternalServerError, "Failed to get access log", nil)
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.written += int64(n)
+	return n, err
+}
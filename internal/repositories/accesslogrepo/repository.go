@@ -0,0 +1,120 @@
+package accesslogrepo
+
+import (
+	"context"
+	"database/sql"
+	"filesms/internal/core/domain"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type postgresShareAccessLogRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresShareAccessLogRepository(db *sql.DB) *postgresShareAccessLogRepository {
+	return &postgresShareAccessLogRepository{db: db}
+}
+
+func (r *postgresShareAccessLogRepository) Create(ctx context.Context, entry *domain.ShareAccessLog) error {
+	query := `INSERT INTO share_access_logs (shared_file_url_id, file_id, accessed_at, ip_address, user_agent, bytes_served, success, denied_reason)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	return r.db.QueryRowContext(ctx, query,
+		entry.SharedFileURLID, entry.FileID, entry.AccessedAt, entry.IPAddress, entry.UserAgent, entry.BytesServed, entry.Success, entry.DeniedReason,
+	).Scan(&entry.ID)
+}
+
+func (r *postgresShareAccessLogRepository) GetBySharedFileURLID(ctx context.Context, sharedFileURLID int64, params domain.AccessLogParams) ([]*domain.ShareAccessLog, error) {
+	return r.history(ctx, `WHERE shared_file_url_id = $1`, sharedFileURLID, params)
+}
+
+func (r *postgresShareAccessLogRepository) GetByFileID(ctx context.Context, fileID uuid.UUID, params domain.AccessLogParams) ([]*domain.ShareAccessLog, error) {
+	return r.history(ctx, `WHERE file_id = $1`, fileID, params)
+}
+
+// history returns the newest entries first. The id breaks ties so pages do
+// not overlap.
+func (r *postgresShareAccessLogRepository) history(ctx context.Context, where string, arg interface{}, params domain.AccessLogParams) ([]*domain.ShareAccessLog, error) {
+	query := `SELECT id, shared_file_url_id, file_id, accessed_at, ip_address, user_agent, bytes_served, success, denied_reason
+              FROM share_access_logs ` + where + `
+              ORDER BY accessed_at DESC, id DESC`
+	args := []interface{}{arg}
+	argCount := 1
+
+	if params.Limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, params.Limit)
+	}
+	if params.Offset > 0 {
+		argCount++
+		query += fmt.Sprintf(" OFFSET $%d", argCount)
+		args = append(args, params.Offset)
+	}
+	return r.query(ctx, query, args...)
+}
+
+func (r *postgresShareAccessLogRepository) GetStatsBySharedFileURLID(ctx context.Context, sharedFileURLID int64) (*domain.ShareAccessStats, error) {
+	return r.stats(ctx, `WHERE shared_file_url_id = $1`, sharedFileURLID)
+}
+
+func (r *postgresShareAccessLogRepository) GetStatsByFileID(ctx context.Context, fileID uuid.UUID) (*domain.ShareAccessStats, error) {
+	return r.stats(ctx, `WHERE file_id = $1`, fileID)
+}
+
+func (r *postgresShareAccessLogRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.ShareAccessLog, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*domain.ShareAccessLog
+	for rows.Next() {
+		var entry domain.ShareAccessLog
+		var sharedFileURLID sql.NullInt64
+		var fileID uuid.NullUUID
+		err := rows.Scan(
+			&entry.ID, &sharedFileURLID, &fileID, &entry.AccessedAt, &entry.IPAddress,
+			&entry.UserAgent, &entry.BytesServed, &entry.Success, &entry.DeniedReason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if sharedFileURLID.Valid {
+			entry.SharedFileURLID = &sharedFileURLID.Int64
+		}
+		if fileID.Valid {
+			entry.FileID = &fileID.UUID
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *postgresShareAccessLogRepository) stats(ctx context.Context, where string, arg interface{}) (*domain.ShareAccessStats, error) {
+	query := `SELECT COUNT(*),
+                     COUNT(*) FILTER (WHERE success),
+                     COUNT(*) FILTER (WHERE NOT success),
+                     COUNT(DISTINCT ip_address),
+                     COALESCE(SUM(bytes_served), 0),
+                     MIN(accessed_at),
+                     MAX(accessed_at)
+              FROM share_access_logs ` + where
+	var stats domain.ShareAccessStats
+	var first, last sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, arg).Scan(
+		&stats.TotalAccesses, &stats.SuccessCount, &stats.DeniedCount, &stats.UniqueIPs, &stats.BytesServed, &first, &last,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if first.Valid {
+		stats.FirstAccessedAt = &first.Time
+	}
+	if last.Valid {
+		stats.LastAccessedAt = &last.Time
+	}
+	return &stats, nil
+}
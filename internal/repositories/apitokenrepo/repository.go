@@ -0,0 +1,115 @@
+package apitokenrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type postgresAPITokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPITokenRepository(db *sql.DB) *postgresAPITokenRepository {
+	return &postgresAPITokenRepository{db: db}
+}
+
+func (r *postgresAPITokenRepository) Create(ctx context.Context, token *domain.APIToken) error {
+	query := `INSERT INTO api_tokens (id, user_id, name, token_prefix, token_hash, scopes, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID, token.UserID, token.Name, token.Prefix, token.TokenHash, pq.Array(token.Scopes), token.ExpiresAt, token.CreatedAt,
+	)
+	return err
+}
+
+func (r *postgresAPITokenRepository) GetByHash(ctx context.Context, tokenHash string) (*domain.APIToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+              FROM api_tokens
+              WHERE token_hash = $1`
+	token, err := scanAPIToken(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("api token not found")
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *postgresAPITokenRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.APIToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+              FROM api_tokens
+              WHERE user_id = $1
+              ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*domain.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *postgresAPITokenRepository) Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	query := `UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("api token not found")
+	}
+	return nil
+}
+
+// TouchLastUsed records a use of the token, at most once a minute to avoid a
+// write on every request.
+func (r *postgresAPITokenRepository) TouchLastUsed(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE api_tokens SET last_used_at = NOW()
+              WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row scanner) (*domain.APIToken, error) {
+	var token domain.APIToken
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash, pq.Array(&token.Scopes),
+		&expiresAt, &lastUsedAt, &revokedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
@@ -0,0 +1,70 @@
+package blobdeletionrepo
+
+import (
+	"context"
+	"database/sql"
+	"filesms/internal/core/domain"
+	"time"
+)
+
+type postgresBlobDeletionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresBlobDeletionRepository(db *sql.DB) *postgresBlobDeletionRepository {
+	return &postgresBlobDeletionRepository{db: db}
+}
+
+func (r *postgresBlobDeletionRepository) Create(ctx context.Context, deletion *domain.BlobDeletion) error {
+	query := `INSERT INTO blob_deletions (storage_key, file_id, reason, next_attempt_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, deletion.StorageKey, deletion.FileID, deletion.Reason, deletion.NextAttemptAt).
+		Scan(&deletion.ID, &deletion.CreatedAt)
+}
+
+// ClaimDue leases up to limit due entries by pushing their next attempt
+// lease into the future, so concurrent workers skip them.
+func (r *postgresBlobDeletionRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*domain.BlobDeletion, error) {
+	query := `UPDATE blob_deletions d
+              SET attempts = d.attempts + 1, next_attempt_at = $2
+              FROM (
+                  SELECT id FROM blob_deletions
+                  WHERE next_attempt_at <= NOW()
+                  ORDER BY next_attempt_at
+                  LIMIT $1
+                  FOR UPDATE SKIP LOCKED
+              ) due
+              WHERE d.id = due.id
+              RETURNING d.id, d.storage_key, d.file_id, d.reason, d.attempts, d.last_error, d.next_attempt_at, d.created_at,
+                  EXISTS (SELECT 1 FROM files f WHERE f.url = d.storage_key)`
+	rows, err := r.db.QueryContext(ctx, query, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*domain.BlobDeletion
+	for rows.Next() {
+		var deletion domain.BlobDeletion
+		if err := rows.Scan(&deletion.ID, &deletion.StorageKey, &deletion.FileID, &deletion.Reason, &deletion.Attempts,
+			&deletion.LastError, &deletion.NextAttemptAt, &deletion.CreatedAt, &deletion.Referenced); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, &deletion)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *postgresBlobDeletionRepository) Complete(ctx context.Context, id int64) error {
+	query := `DELETE FROM blob_deletions WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Fail records why an attempt failed and when to retry.
+func (r *postgresBlobDeletionRepository) Fail(ctx context.Context, id int64, lastError string, retryAt time.Time) error {
+	query := `UPDATE blob_deletions SET last_error = $2, next_attempt_at = $3 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, lastError, retryAt)
+	return err
+}
@@ -12,6 +12,11 @@ import (
 	"github.com/google/uuid"
 )
 
+// notLocked matches files neither under legal hold, directly or through
+// their owner, nor retained
+const notLocked = `NOT files.legal_hold AND (files.retain_until IS NULL OR files.retain_until <= NOW())
+              AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = files.user_id AND users.legal_hold)`
+
 type postgresFileRepository struct {
 	db *sql.DB
 }
@@ -20,23 +25,45 @@ func NewPostgresFileRepository(db *sql.DB) *postgresFileRepository {
 	return &postgresFileRepository{db: db}
 }
 
+// Create commits an uploaded file. The blob's pending upload deletion is
+// cancelled in the same transaction; if the worker has already claimed it
+// the blob is being removed and the upload fails.
 func (r *postgresFileRepository) Create(ctx context.Context, file *domain.File) error {
-	query := `INSERT INTO files (id, user_id, name, size, type, url, created_at, updated_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := r.db.ExecContext(ctx, query, file.ID, file.UserID, file.Name, file.Size, file.Type, file.URL, file.CreatedAt, file.UpdatedAt)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM blob_deletions WHERE file_id = $1 AND storage_key = $2 AND reason = $3 AND attempts = 0`,
+		file.ID, file.URL, domain.BlobDeletionUpload)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("upload expired before it was committed")
+	}
+
+	query := `INSERT INTO files (id, user_id, name, size, type, mime_type, sha256, url, expiration_date, expiration_pinned, scan_status, created_at, updated_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	if _, err := tx.ExecContext(ctx, query, file.ID, file.UserID, file.Name, file.Size, file.Type, file.MIMEType, file.SHA256, file.URL, file.ExpirationDate, file.ExpirationPinned, file.ScanStatus, file.CreatedAt, file.UpdatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 func (r *postgresFileRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.File, error) {
-	query := `SELECT id, user_id, name, size, type, url, created_at, updated_at 
+	query := `SELECT id, user_id, name, size, type, mime_type, sha256, url, storage_class, expiration_date, expiration_pinned, last_accessed_at, legal_hold, retain_until, scan_status, scan_result, scanned_at, created_at, updated_at 
               FROM files 
               WHERE id = $1`
 	var file domain.File
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.URL, &file.CreatedAt, &file.UpdatedAt,
+		&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL, &file.StorageClass, &file.ExpirationDate, &file.ExpirationPinned, &file.LastAccessedAt, &file.LegalHold, &file.RetainUntil, &file.ScanStatus, &file.ScanResult, &file.ScannedAt, &file.CreatedAt, &file.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("file not found")
+			return nil, domain.ErrFileNotFound
 		}
 		return nil, err
 	}
@@ -44,7 +71,7 @@ func (r *postgresFileRepository) GetByID(ctx context.Context, id uuid.UUID) (*do
 }
 
 func (r *postgresFileRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.File, error) {
-	query := `SELECT id, user_id, name, size, type, url, created_at, updated_at 
+	query := `SELECT id, user_id, name, size, type, mime_type, sha256, url, storage_class, expiration_date, expiration_pinned, last_accessed_at, legal_hold, retain_until, scan_status, scan_result, scanned_at, created_at, updated_at 
               FROM files 
               WHERE user_id = $1 
               ORDER BY created_at DESC`
@@ -57,18 +84,203 @@ func (r *postgresFileRepository) GetByUserID(ctx context.Context, userID uuid.UU
 	var files []*domain.File
 	for rows.Next() {
 		var file domain.File
-		if err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.URL, &file.CreatedAt, &file.UpdatedAt); err != nil {
+		if err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL, &file.StorageClass, &file.ExpirationDate, &file.ExpirationPinned, &file.LastAccessedAt, &file.LegalHold, &file.RetainUntil, &file.ScanStatus, &file.ScanResult, &file.ScannedAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
 			return nil, err
 		}
 		files = append(files, &file)
 	}
 	return files, nil
 }
-func (r *postgresFileRepository) SaveSharedFileURL(ctx context.Context, sharedFileURL *domain.SharedFileURL) error {
-	query := `INSERT INTO shared_file_urls (file_id, url, expires_at, created_at) VALUES ($1, $2, $3, $4)`
-	_, err := r.db.ExecContext(ctx, query, sharedFileURL.FileID, sharedFileURL.URL, sharedFileURL.ExpiresAt, sharedFileURL.CreatedAt)
+
+// GetBatch returns up to limit files with IDs greater than afterID, for
+// walking the whole table in ID order.
+func (r *postgresFileRepository) GetBatch(ctx context.Context, afterID uuid.UUID, limit int) ([]*domain.File, error) {
+	query := `SELECT id, user_id, name, size, type, mime_type, sha256, url, storage_class, expiration_date, expiration_pinned, last_accessed_at, legal_hold, retain_until, scan_status, scan_result, scanned_at, created_at, updated_at
+              FROM files
+              WHERE id > $1
+              ORDER BY id
+              LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		var file domain.File
+		if err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL, &file.StorageClass, &file.ExpirationDate, &file.ExpirationPinned, &file.LastAccessedAt, &file.LegalHold, &file.RetainUntil, &file.ScanStatus, &file.ScanResult, &file.ScannedAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+func (r *postgresFileRepository) UpdateChecksum(ctx context.Context, id uuid.UUID, sha256 string) error {
+	query := `UPDATE files SET sha256 = $2 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, sha256)
+	return err
+}
+
+func (r *postgresFileRepository) UpdateScanStatus(ctx context.Context, id uuid.UUID, status, result string, scannedAt time.Time) error {
+	query := `UPDATE files SET scan_status = $2, scan_result = $3, scanned_at = $4 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, status, result, scannedAt)
+	return err
+}
+
+func (r *postgresFileRepository) SetQuarantineKey(ctx context.Context, id uuid.UUID, key string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE files SET quarantine_key = $2 WHERE id = $1`, id, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateExpiration sets the computed expiration of a file whose expiration
+// is not pinned. A changed date is announced to the owner again.
+func (r *postgresFileRepository) UpdateExpiration(ctx context.Context, id uuid.UUID, expiration *time.Time) error {
+	query := `UPDATE files
+              SET expiration_date = $2,
+                  expiry_notified_at = CASE WHEN expiration_date IS DISTINCT FROM $2 THEN NULL ELSE expiry_notified_at END
+              WHERE id = $1 AND NOT expiration_pinned`
+	_, err := r.db.ExecContext(ctx, query, id, expiration)
+	return err
+}
+
+func (r *postgresFileRepository) TouchAccess(ctx context.Context, id uuid.UUID, accessedAt time.Time) error {
+	query := `UPDATE files SET last_accessed_at = $2 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, accessedAt)
+	return err
+}
+
+// ChangeStorageClass points a file at a copy of its blob under newKey and
+// queues the old blob for removal. It reports false if the file was deleted
+// or moved meanwhile.
+func (r *postgresFileRepository) ChangeStorageClass(ctx context.Context, id uuid.UUID, oldKey, newKey, storageClass string) (bool, error) {
+	query := `WITH moved AS (
+                  UPDATE files SET url = $3, storage_class = $4, updated_at = NOW()
+                  WHERE id = $1 AND url = $2
+                  RETURNING id
+              )
+              INSERT INTO blob_deletions (storage_key, file_id, reason)
+              SELECT $2, id, $5 FROM moved`
+	result, err := r.db.ExecContext(ctx, query, id, oldKey, newKey, storageClass, domain.BlobDeletionMoved)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetExpiringUnnotified returns files expiring before the given time whose
+// owners have not been told yet.
+func (r *postgresFileRepository) GetExpiringUnnotified(ctx context.Context, before time.Time) ([]*domain.File, error) {
+	query := `SELECT id, user_id, name, size, type, mime_type, sha256, url, storage_class, expiration_date, expiration_pinned, last_accessed_at, legal_hold, retain_until, scan_status, scan_result, scanned_at, created_at, updated_at
+              FROM files
+              WHERE expiration_date BETWEEN NOW() AND $1 AND expiry_notified_at IS NULL AND ` + notLocked + `
+              ORDER BY user_id, expiration_date`
+	rows, err := r.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		var file domain.File
+		if err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL, &file.StorageClass, &file.ExpirationDate, &file.ExpirationPinned, &file.LastAccessedAt, &file.LegalHold, &file.RetainUntil, &file.ScanStatus, &file.ScanResult, &file.ScannedAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+// GetUnprocessed returns files uploaded before the given time that are still
+// waiting for a scan and have no processing job at all.
+func (r *postgresFileRepository) GetUnprocessed(ctx context.Context, before time.Time, limit int) ([]*domain.File, error) {
+	query := `SELECT id, user_id, name, size, type, mime_type, sha256, url, storage_class, expiration_date, expiration_pinned, last_accessed_at, legal_hold, retain_until, scan_status, scan_result, scanned_at, created_at, updated_at
+              FROM files f
+              WHERE f.scan_status = $1 AND f.created_at < $2
+                  AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.payload->>'file_id' = f.id::text AND j.type = $3)
+              ORDER BY f.created_at
+              LIMIT $4`
+	rows, err := r.db.QueryContext(ctx, query, domain.ScanStatusPending, before, domain.JobFileUploaded, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		var file domain.File
+		if err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL, &file.StorageClass, &file.ExpirationDate, &file.ExpirationPinned, &file.LastAccessedAt, &file.LegalHold, &file.RetainUntil, &file.ScanStatus, &file.ScanResult, &file.ScannedAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+func (r *postgresFileRepository) MarkExpiryNotified(ctx context.Context, fileIDs []uuid.UUID) error {
+	query := `UPDATE files SET expiry_notified_at = NOW() WHERE id = ANY($1)`
+	_, err := r.db.ExecContext(ctx, query, convertUUIDsToPGArray(fileIDs))
 	return err
 }
+
+func (r *postgresFileRepository) SaveSharedFileURL(ctx context.Context, sharedFileURL *domain.SharedFileURL) error {
+	query := `INSERT INTO shared_file_urls (file_id, url, expires_at, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	return r.db.QueryRowContext(ctx, query, sharedFileURL.FileID, sharedFileURL.URL, sharedFileURL.ExpiresAt, sharedFileURL.CreatedAt).Scan(&sharedFileURL.ID)
+}
+func (r *postgresFileRepository) GetSharedFileURL(ctx context.Context, url string) (*domain.SharedFileURL, error) {
+	query := `SELECT id, file_id, url, expires_at, created_at FROM shared_file_urls WHERE url = $1`
+	var sharedFileURL domain.SharedFileURL
+	err := r.db.QueryRowContext(ctx, query, url).Scan(
+		&sharedFileURL.ID, &sharedFileURL.FileID, &sharedFileURL.URL, &sharedFileURL.ExpiresAt, &sharedFileURL.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("shared URL not found")
+		}
+		return nil, err
+	}
+	return &sharedFileURL, nil
+}
+func (r *postgresFileRepository) GetSharedFileURLsByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.SharedFileURL, error) {
+	query := `SELECT s.id, s.file_id, s.url, s.expires_at, s.created_at
+              FROM shared_file_urls s
+              JOIN files f ON f.id = s.file_id
+              WHERE f.user_id = $1
+              ORDER BY s.created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sharedFileURLs []*domain.SharedFileURL
+	for rows.Next() {
+		var sharedFileURL domain.SharedFileURL
+		if err := rows.Scan(&sharedFileURL.ID, &sharedFileURL.FileID, &sharedFileURL.URL, &sharedFileURL.ExpiresAt, &sharedFileURL.CreatedAt); err != nil {
+			return nil, err
+		}
+		sharedFileURLs = append(sharedFileURLs, &sharedFileURL)
+	}
+	return sharedFileURLs, rows.Err()
+}
+
+// DeleteExpiredSharedFileURLs removes share links that expired before the
+// given time.
+func (r *postgresFileRepository) DeleteExpiredSharedFileURLs(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM shared_file_urls WHERE expires_at < $1`
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
 func (r *postgresFileRepository) GetFileIDBySharedURL(ctx context.Context, url string) (uuid.UUID, error) {
 	query := `SELECT file_id FROM shared_file_urls WHERE url = $1 AND expires_at > NOW()`
 	var fileID uuid.UUID
@@ -83,7 +295,7 @@ func (r *postgresFileRepository) GetFileIDBySharedURL(ctx context.Context, url s
 }
 func (r *postgresFileRepository) Search(ctx context.Context, userID uuid.UUID, params domain.FileSearchParams) ([]*domain.File, error) {
 	query := `
-		SELECT id, user_id, name, size, type, url, created_at, updated_at
+		SELECT id, user_id, name, size, type, mime_type, sha256, url, storage_class, expiration_date, expiration_pinned, last_accessed_at, legal_hold, retain_until, scan_status, scan_result, scanned_at, created_at, updated_at
 		FROM files
 		WHERE user_id = $1
 	`
@@ -142,7 +354,7 @@ func (r *postgresFileRepository) Search(ctx context.Context, userID uuid.UUID, p
 	var files []*domain.File
 	for rows.Next() {
 		var file domain.File
-		err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.URL, &file.CreatedAt, &file.UpdatedAt)
+		err := rows.Scan(&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL, &file.StorageClass, &file.ExpirationDate, &file.ExpirationPinned, &file.LastAccessedAt, &file.LegalHold, &file.RetainUntil, &file.ScanStatus, &file.ScanResult, &file.ScannedAt, &file.CreatedAt, &file.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -151,12 +363,39 @@ func (r *postgresFileRepository) Search(ctx context.Context, userID uuid.UUID, p
 
 	return files, nil
 }
+
+// CountLocked returns how many of the files are under legal hold or
+// retention and so cannot be deleted.
+func (r *postgresFileRepository) CountLocked(ctx context.Context, fileIDs []uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM files WHERE id = ANY($1) AND NOT (` + notLocked + `)`
+	var count int
+	err := r.db.QueryRowContext(ctx, query, convertUUIDsToPGArray(fileIDs)).Scan(&count)
+	return count, err
+}
+
+// DeleteFiles deletes the files that are not locked.
 func (r *postgresFileRepository) DeleteFiles(ctx context.Context, fileIDs []uuid.UUID) error {
 	// Convert UUID slice to PostgreSQL array format
 	pgArray := convertUUIDsToPGArray(fileIDs)
 
-	query := `DELETE FROM files WHERE id = ANY($1)`
-	_, err := r.db.ExecContext(ctx, query, pgArray)
+	// Deleted sizes are handed back to their owners' storage usage, and the
+	// blobs, thumbnails and quarantined copies included, are queued for
+	// removal in the same statement. The thumbnail rows cascade after it, so
+	// they are still seen.
+	query := `WITH deleted AS (
+                  DELETE FROM files WHERE id = ANY($1) AND ` + notLocked + ` RETURNING id, user_id, size, url, quarantine_key
+              ), queued AS (
+                  INSERT INTO blob_deletions (storage_key, file_id, reason)
+                  SELECT url, id, $2 FROM deleted
+                  UNION ALL
+                  SELECT quarantine_key, id, $2 FROM deleted WHERE quarantine_key IS NOT NULL
+                  UNION ALL
+                  SELECT t.storage_key, t.file_id, $2 FROM thumbnails t JOIN deleted d ON d.id = t.file_id
+              )
+              UPDATE users u SET storage_used = GREATEST(u.storage_used - d.total, 0)
+              FROM (SELECT user_id, SUM(size) AS total FROM deleted GROUP BY user_id) d
+              WHERE u.id = d.user_id`
+	_, err := r.db.ExecContext(ctx, query, pgArray, domain.BlobDeletionFile)
 	return err
 }
 
@@ -170,10 +409,9 @@ func convertUUIDsToPGArray(uuids []uuid.UUID) string {
 }
 func (r *postgresFileRepository) GetExpiredFiles(ctx context.Context) ([]*domain.File, error) {
 	query := `
-        SELECT id, user_id, name, size, type, url, expiration_date, created_at, updated_at
+        SELECT id, user_id, name, size, type, mime_type, sha256, url, expiration_date, created_at, updated_at
         FROM files
-        WHERE expiration_date < $1
-    `
+        WHERE expiration_date < $1 AND ` + notLocked
 	rows, err := r.db.QueryContext(ctx, query, time.Now())
 	if err != nil {
 		return nil, err
@@ -184,7 +422,7 @@ func (r *postgresFileRepository) GetExpiredFiles(ctx context.Context) ([]*domain
 	for rows.Next() {
 		var file domain.File
 		err := rows.Scan(
-			&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.URL,
+			&file.ID, &file.UserID, &file.Name, &file.Size, &file.Type, &file.MIMEType, &file.SHA256, &file.URL,
 			&file.ExpirationDate, &file.CreatedAt, &file.UpdatedAt,
 		)
 		if err != nil {
@@ -194,3 +432,26 @@ func (r *postgresFileRepository) GetExpiredFiles(ctx context.Context) ([]*domain
 	}
 	return files, nil
 }
+
+func (r *postgresFileRepository) GetUsageByUserID(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(size), 0) FROM files WHERE user_id = $1`
+	usage := &domain.StorageUsage{UserID: userID, ByType: []domain.TypeUsage{}}
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&usage.FileCount, &usage.TotalBytes); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT type, COUNT(*), SUM(size) FROM files WHERE user_id = $1 GROUP BY type ORDER BY SUM(size) DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var typeUsage domain.TypeUsage
+		if err := rows.Scan(&typeUsage.Type, &typeUsage.FileCount, &typeUsage.TotalBytes); err != nil {
+			return nil, err
+		}
+		usage.ByType = append(usage.ByType, typeUsage)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,41 @@
+package identityrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+)
+
+type postgresUserIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserIdentityRepository(db *sql.DB) *postgresUserIdentityRepository {
+	return &postgresUserIdentityRepository{db: db}
+}
+
+func (r *postgresUserIdentityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	query := `INSERT INTO user_identities (id, user_id, provider, issuer, subject, email, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query,
+		identity.ID, identity.UserID, identity.Provider, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt,
+	)
+	return err
+}
+
+func (r *postgresUserIdentityRepository) GetByIssuerSubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error) {
+	query := `SELECT id, user_id, provider, issuer, subject, email, created_at
+              FROM user_identities
+              WHERE issuer = $1 AND subject = $2`
+	var identity domain.UserIdentity
+	err := r.db.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("identity not found")
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
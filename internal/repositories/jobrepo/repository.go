@@ -0,0 +1,193 @@
+package jobrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const jobColumns = `id, type, payload, status, attempts, max_attempts, last_error, run_at, locked_by, locked_until, created_at, updated_at, finished_at`
+
+type postgresJobRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresJobRepository(db *sql.DB) *postgresJobRepository {
+	return &postgresJobRepository{db: db}
+}
+
+func (r *postgresJobRepository) Create(ctx context.Context, job *domain.Job) error {
+	query := `INSERT INTO jobs (type, payload, status, max_attempts, run_at, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $6)
+              RETURNING id`
+	return r.db.QueryRowContext(ctx, query, job.Type, []byte(job.Payload), job.Status, job.MaxAttempts, job.RunAt, job.CreatedAt).Scan(&job.ID)
+}
+
+// Claim locks the next due job of one of the types for workerID until
+// lockedUntil. Running jobs whose lock expired are due again. It returns
+// nil if there is nothing to do.
+func (r *postgresJobRepository) Claim(ctx context.Context, workerID string, types []string, lockedUntil time.Time) (*domain.Job, error) {
+	query := `UPDATE jobs
+              SET status = $1, attempts = attempts + 1, locked_by = $2, locked_until = $3, updated_at = NOW()
+              WHERE id = (
+                  SELECT id FROM jobs
+                  WHERE type = ANY($4)
+                    AND ((status = $5 AND run_at <= NOW()) OR (status = $1 AND locked_until < NOW()))
+                  ORDER BY run_at
+                  LIMIT 1
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING ` + jobColumns
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, domain.JobStatusRunning, workerID, lockedUntil, pq.Array(types), domain.JobStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Complete marks a claimed job succeeded. Like Fail, it only applies while
+// the job is still the attempt this worker claimed; once the lease ran out
+// and another worker claimed it, the outcome belongs to that attempt.
+func (r *postgresJobRepository) Complete(ctx context.Context, job *domain.Job) error {
+	query := `UPDATE jobs
+              SET status = $4, last_error = '', locked_by = NULL, locked_until = NULL, updated_at = NOW(), finished_at = NOW()
+              WHERE id = $1 AND locked_by = $2 AND attempts = $3`
+	result, err := r.db.ExecContext(ctx, query, job.ID, job.LockedBy, job.Attempts, domain.JobStatusSucceeded)
+	return checkClaimed(job, result, err)
+}
+
+// Fail records a failed attempt. The job runs again at retryAt, or is moved
+// to the dead-letter state if retryAt is nil.
+func (r *postgresJobRepository) Fail(ctx context.Context, job *domain.Job, lastError string, retryAt *time.Time) error {
+	if retryAt == nil {
+		query := `UPDATE jobs
+                  SET status = $4, last_error = $5, locked_by = NULL, locked_until = NULL, updated_at = NOW(), finished_at = NOW()
+                  WHERE id = $1 AND locked_by = $2 AND attempts = $3`
+		result, err := r.db.ExecContext(ctx, query, job.ID, job.LockedBy, job.Attempts, domain.JobStatusDead, lastError)
+		return checkClaimed(job, result, err)
+	}
+	query := `UPDATE jobs
+              SET status = $4, last_error = $5, run_at = $6, locked_by = NULL, locked_until = NULL, updated_at = NOW()
+              WHERE id = $1 AND locked_by = $2 AND attempts = $3`
+	result, err := r.db.ExecContext(ctx, query, job.ID, job.LockedBy, job.Attempts, domain.JobStatusPending, lastError, *retryAt)
+	return checkClaimed(job, result, err)
+}
+
+func checkClaimed(job *domain.Job, result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("job %d lost its lease to another attempt", job.ID)
+	}
+	return nil
+}
+
+// Retry puts a dead job back in the queue with fresh attempts.
+func (r *postgresJobRepository) Retry(ctx context.Context, id int64) error {
+	query := `UPDATE jobs
+              SET status = $2, attempts = 0, run_at = NOW(), updated_at = NOW(), finished_at = NULL
+              WHERE id = $1 AND status = $3`
+	result, err := r.db.ExecContext(ctx, query, id, domain.JobStatusPending, domain.JobStatusDead)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("dead job not found")
+	}
+	return nil
+}
+
+func (r *postgresJobRepository) GetByID(ctx context.Context, id int64) (*domain.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("job not found")
+	}
+	return job, err
+}
+
+func (r *postgresJobRepository) Search(ctx context.Context, params domain.JobSearchParams) ([]*domain.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE TRUE`
+	var args []interface{}
+	argCount := 0
+
+	if params.Status != "" {
+		argCount++
+		query += fmt.Sprintf(" AND status = $%d", argCount)
+		args = append(args, params.Status)
+	}
+	if params.Type != "" {
+		argCount++
+		query += fmt.Sprintf(" AND type = $%d", argCount)
+		args = append(args, params.Type)
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	if params.Limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, params.Limit)
+	}
+	if params.Offset > 0 {
+		argCount++
+		query += fmt.Sprintf(" OFFSET $%d", argCount)
+		args = append(args, params.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*domain.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteSucceeded removes jobs that succeeded before the given time.
+func (r *postgresJobRepository) DeleteSucceeded(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM jobs WHERE status = $1 AND finished_at < $2`
+	result, err := r.db.ExecContext(ctx, query, domain.JobStatusSucceeded, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*domain.Job, error) {
+	var job domain.Job
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.LastError,
+		&job.RunAt, &job.LockedBy, &job.LockedUntil, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	return &job, nil
+}
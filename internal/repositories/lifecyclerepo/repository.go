@@ -0,0 +1,82 @@
+package lifecyclerepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+type postgresLifecyclePolicyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresLifecyclePolicyRepository(db *sql.DB) *postgresLifecyclePolicyRepository {
+	return &postgresLifecyclePolicyRepository{db: db}
+}
+
+func (r *postgresLifecyclePolicyRepository) Create(ctx context.Context, policy *domain.LifecyclePolicy) error {
+	query := `INSERT INTO lifecycle_policies (id, user_id, file_type, action, days, basis, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, policy.ID, policy.UserID, policy.FileType, policy.Action, policy.Days, policy.Basis, policy.CreatedAt)
+	return err
+}
+
+func (r *postgresLifecyclePolicyRepository) GetAll(ctx context.Context) ([]*domain.LifecyclePolicy, error) {
+	query := `SELECT id, user_id, file_type, action, days, basis, created_at
+              FROM lifecycle_policies
+              ORDER BY created_at`
+	return r.query(ctx, query)
+}
+
+func (r *postgresLifecyclePolicyRepository) GetApplicable(ctx context.Context, userID uuid.UUID) ([]*domain.LifecyclePolicy, error) {
+	query := `SELECT id, user_id, file_type, action, days, basis, created_at
+              FROM lifecycle_policies
+              WHERE user_id IS NULL OR user_id = $1
+              ORDER BY created_at`
+	return r.query(ctx, query, userID)
+}
+
+func (r *postgresLifecyclePolicyRepository) GetByOwner(ctx context.Context, userID *uuid.UUID) ([]*domain.LifecyclePolicy, error) {
+	query := `SELECT id, user_id, file_type, action, days, basis, created_at
+              FROM lifecycle_policies
+              WHERE user_id IS NOT DISTINCT FROM $1
+              ORDER BY created_at`
+	return r.query(ctx, query, userID)
+}
+
+func (r *postgresLifecyclePolicyRepository) Delete(ctx context.Context, id uuid.UUID, userID *uuid.UUID) error {
+	query := `DELETE FROM lifecycle_policies WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("lifecycle policy not found")
+	}
+	return nil
+}
+
+func (r *postgresLifecyclePolicyRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.LifecyclePolicy, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*domain.LifecyclePolicy
+	for rows.Next() {
+		var policy domain.LifecyclePolicy
+		if err := rows.Scan(&policy.ID, &policy.UserID, &policy.FileType, &policy.Action, &policy.Days, &policy.Basis, &policy.CreatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, &policy)
+	}
+	return policies, rows.Err()
+}
@@ -0,0 +1,88 @@
+package retentionrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type postgresRetentionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRetentionRepository(db *sql.DB) *postgresRetentionRepository {
+	return &postgresRetentionRepository{db: db}
+}
+
+// SetFileLegalHold places or releases a hold on a file and records the
+// event in the same transaction.
+func (r *postgresRetentionRepository) SetFileLegalHold(ctx context.Context, fileID uuid.UUID, hold bool, event *domain.RetentionEvent) error {
+	return r.withEvent(ctx, event, `UPDATE files SET legal_hold = $2 WHERE id = $1`, fileID, hold)
+}
+
+func (r *postgresRetentionRepository) SetUserLegalHold(ctx context.Context, userID uuid.UUID, hold bool, event *domain.RetentionEvent) error {
+	return r.withEvent(ctx, event, `UPDATE users SET legal_hold = $2 WHERE id = $1`, userID, hold)
+}
+
+// ExtendFileRetention locks a file until the given time. An existing lock
+// can only be extended.
+func (r *postgresRetentionRepository) ExtendFileRetention(ctx context.Context, fileID uuid.UUID, until time.Time, event *domain.RetentionEvent) error {
+	query := `UPDATE files SET retain_until = $2
+              WHERE id = $1 AND (retain_until IS NULL OR retain_until <= $2)`
+	return r.withEvent(ctx, event, query, fileID, until)
+}
+
+// withEvent runs an update that must touch exactly one row together with
+// inserting its audit event.
+func (r *postgresRetentionRepository) withEvent(ctx context.Context, event *domain.RetentionEvent, query string, args ...interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("retention target not found or lock would be shortened")
+	}
+
+	insert := `INSERT INTO retention_events (actor_id, action, file_id, user_id, retain_until, reason, created_at)
+               VALUES ($1, $2, $3, $4, $5, $6, $7)
+               RETURNING id`
+	if err := tx.QueryRowContext(ctx, insert, event.ActorID, event.Action, event.FileID, event.UserID, event.RetainUntil, event.Reason, event.CreatedAt).Scan(&event.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetEvents returns the audit trail of a file, a user or both, newest first.
+func (r *postgresRetentionRepository) GetEvents(ctx context.Context, fileID, userID *uuid.UUID) ([]*domain.RetentionEvent, error) {
+	query := `SELECT id, actor_id, action, file_id, user_id, retain_until, reason, created_at
+              FROM retention_events
+              WHERE ($1::uuid IS NULL OR file_id = $1) AND ($2::uuid IS NULL OR user_id = $2)
+              ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.RetentionEvent
+	for rows.Next() {
+		var event domain.RetentionEvent
+		if err := rows.Scan(&event.ID, &event.ActorID, &event.Action, &event.FileID, &event.UserID, &event.RetainUntil, &event.Reason, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
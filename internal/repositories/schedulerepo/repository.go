@@ -0,0 +1,94 @@
+package schedulerepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+	"time"
+)
+
+const taskColumns = `name, schedule, enabled, run_requested_at, last_started_at, last_finished_at, last_status, last_error`
+
+type postgresScheduledTaskRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresScheduledTaskRepository(db *sql.DB) *postgresScheduledTaskRepository {
+	return &postgresScheduledTaskRepository{db: db}
+}
+
+func (r *postgresScheduledTaskRepository) GetAll(ctx context.Context) ([]*domain.TaskState, error) {
+	query := `SELECT ` + taskColumns + ` FROM scheduled_tasks ORDER BY name`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []*domain.TaskState
+	for rows.Next() {
+		state, err := scanTaskState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+func (r *postgresScheduledTaskRepository) Get(ctx context.Context, name string) (*domain.TaskState, error) {
+	query := `SELECT ` + taskColumns + ` FROM scheduled_tasks WHERE name = $1`
+	state, err := scanTaskState(r.db.QueryRowContext(ctx, query, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return &domain.TaskState{Name: name}, nil
+	}
+	return state, err
+}
+
+func (r *postgresScheduledTaskRepository) SetConfig(ctx context.Context, name string, schedule *string, enabled *bool) error {
+	query := `INSERT INTO scheduled_tasks (name, schedule, enabled)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (name) DO UPDATE SET schedule = $2, enabled = $3, updated_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, name, schedule, enabled)
+	return err
+}
+
+func (r *postgresScheduledTaskRepository) RequestRun(ctx context.Context, name string) error {
+	query := `INSERT INTO scheduled_tasks (name, run_requested_at)
+              VALUES ($1, NOW())
+              ON CONFLICT (name) DO UPDATE SET run_requested_at = NOW(), updated_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, name)
+	return err
+}
+
+// MarkStarted records a run and consumes any pending run request.
+func (r *postgresScheduledTaskRepository) MarkStarted(ctx context.Context, name string, startedAt time.Time) error {
+	query := `INSERT INTO scheduled_tasks (name, last_started_at, last_status)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (name) DO UPDATE
+              SET run_requested_at = NULL, last_started_at = $2, last_status = $3, last_error = '', updated_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, name, startedAt, domain.TaskStatusRunning)
+	return err
+}
+
+func (r *postgresScheduledTaskRepository) MarkFinished(ctx context.Context, name string, finishedAt time.Time, status, lastError string) error {
+	query := `UPDATE scheduled_tasks
+              SET last_finished_at = $2, last_status = $3, last_error = $4, updated_at = NOW()
+              WHERE name = $1`
+	_, err := r.db.ExecContext(ctx, query, name, finishedAt, status, lastError)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTaskState(row scanner) (*domain.TaskState, error) {
+	var state domain.TaskState
+	err := row.Scan(&state.Name, &state.Schedule, &state.Enabled, &state.RunRequestedAt, &state.LastStartedAt, &state.LastFinishedAt, &state.LastStatus, &state.LastError)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
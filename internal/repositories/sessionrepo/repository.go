@@ -0,0 +1,114 @@
+package sessionrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type postgresSessionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionRepository(db *sql.DB) *postgresSessionRepository {
+	return &postgresSessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, user_agent, ip_address, expires_at, revoked_at, last_seen_at, created_at`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row scanner) (*domain.Session, error) {
+	var session domain.Session
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.ExpiresAt, &revokedAt, &session.LastSeenAt, &session.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+func (r *postgresSessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at, last_seen_at, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IPAddress,
+		session.ExpiresAt, session.LastSeenAt, session.CreatedAt)
+	return err
+}
+
+func (r *postgresSessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("session not found")
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *postgresSessionRepository) GetActiveByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+              WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+              ORDER BY last_seen_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*domain.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records activity on the session. A non-zero expiresAt also extends it.
+func (r *postgresSessionRepository) Touch(ctx context.Context, id uuid.UUID, ipAddress string, seenAt, expiresAt time.Time) error {
+	query := `UPDATE sessions
+              SET last_seen_at = $2, ip_address = $3, expires_at = GREATEST(expires_at, $4)
+              WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, seenAt, ipAddress, expiresAt)
+	return err
+}
+
+// Revoke marks the session and all of its refresh tokens revoked.
+func (r *postgresSessionRepository) Revoke(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = $1 AND revoked_at IS NULL`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresSessionRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
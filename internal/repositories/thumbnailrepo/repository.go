@@ -0,0 +1,109 @@
+package thumbnailrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+type postgresThumbnailRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresThumbnailRepository(db *sql.DB) *postgresThumbnailRepository {
+	return &postgresThumbnailRepository{db: db}
+}
+
+// Save stores a thumbnail, replacing an earlier one of the same size.
+func (r *postgresThumbnailRepository) Save(ctx context.Context, thumbnail *domain.Thumbnail) error {
+	query := `INSERT INTO thumbnails (file_id, size, storage_key, mime_type, width, height, bytes)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)
+              ON CONFLICT (file_id, size) DO UPDATE
+              SET storage_key = EXCLUDED.storage_key, mime_type = EXCLUDED.mime_type, width = EXCLUDED.width,
+                  height = EXCLUDED.height, bytes = EXCLUDED.bytes, created_at = NOW()
+              RETURNING created_at`
+	return r.db.QueryRowContext(ctx, query, thumbnail.FileID, thumbnail.Size, thumbnail.StorageKey, thumbnail.MIMEType,
+		thumbnail.Width, thumbnail.Height, thumbnail.Bytes).Scan(&thumbnail.CreatedAt)
+}
+
+func (r *postgresThumbnailRepository) Get(ctx context.Context, fileID uuid.UUID, size string) (*domain.Thumbnail, error) {
+	query := `SELECT file_id, size, storage_key, mime_type, width, height, bytes, created_at
+              FROM thumbnails
+              WHERE file_id = $1 AND size = $2`
+	var thumbnail domain.Thumbnail
+	err := r.db.QueryRowContext(ctx, query, fileID, size).Scan(&thumbnail.FileID, &thumbnail.Size, &thumbnail.StorageKey,
+		&thumbnail.MIMEType, &thumbnail.Width, &thumbnail.Height, &thumbnail.Bytes, &thumbnail.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("thumbnail not found")
+		}
+		return nil, err
+	}
+	return &thumbnail, nil
+}
+
+func (r *postgresThumbnailRepository) GetByFileID(ctx context.Context, fileID uuid.UUID) ([]*domain.Thumbnail, error) {
+	query := `SELECT file_id, size, storage_key, mime_type, width, height, bytes, created_at
+              FROM thumbnails
+              WHERE file_id = $1
+              ORDER BY width`
+	rows, err := r.db.QueryContext(ctx, query, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thumbnails []*domain.Thumbnail
+	for rows.Next() {
+		var thumbnail domain.Thumbnail
+		if err := rows.Scan(&thumbnail.FileID, &thumbnail.Size, &thumbnail.StorageKey, &thumbnail.MIMEType,
+			&thumbnail.Width, &thumbnail.Height, &thumbnail.Bytes, &thumbnail.CreatedAt); err != nil {
+			return nil, err
+		}
+		thumbnails = append(thumbnails, &thumbnail)
+	}
+	return thumbnails, rows.Err()
+}
+
+// GetKeysBatch returns up to limit storage keys greater than afterKey, for
+// walking all thumbnail blobs in key order.
+func (r *postgresThumbnailRepository) GetKeysBatch(ctx context.Context, afterKey string, limit int) ([]string, error) {
+	query := `SELECT storage_key FROM thumbnails
+              WHERE storage_key > $1
+              ORDER BY storage_key
+              LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, afterKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// MarkFailed records that no thumbnail can be made of the file.
+func (r *postgresThumbnailRepository) MarkFailed(ctx context.Context, fileID uuid.UUID, reason string) error {
+	query := `INSERT INTO thumbnail_failures (file_id, error)
+              VALUES ($1, $2)
+              ON CONFLICT (file_id) DO UPDATE SET error = EXCLUDED.error, created_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, fileID, reason)
+	return err
+}
+
+func (r *postgresThumbnailRepository) HasFailed(ctx context.Context, fileID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM thumbnail_failures WHERE file_id = $1)`
+	var failed bool
+	err := r.db.QueryRowContext(ctx, query, fileID).Scan(&failed)
+	return failed, err
+}
@@ -5,53 +5,185 @@ import (
 	"database/sql"
 	"errors"
 	"filesms/internal/core/domain"
+	"fmt"
 
 	"github.com/google/uuid"
 )
 
+const userColumns = `id, email, password, email_verified, role, disabled, storage_quota, totp_secret, totp_enabled, legal_hold, created_at, updated_at`
+
 type postgresUserRepository struct {
 	db *sql.DB
 }
 
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
 func NewPostgresUserRepository(db *sql.DB) *postgresUserRepository {
 	return &postgresUserRepository{db: db}
 }
 func (r *postgresUserRepository) Create(ctx context.Context, user *domain.User) error {
-	query := `INSERT INTO users (id, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	err := r.db.QueryRowContext(ctx, query, user.ID, user.Email, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+	if user.Role == "" {
+		user.Role = domain.RoleUser
+	}
+	query := `INSERT INTO users (id, email, password, email_verified, role, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := r.db.QueryRowContext(ctx, query, user.ID, user.Email, user.Password, user.EmailVerified, user.Role, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
 	return err
 }
+
+// Delete removes the user. Their remaining files cascade with them, so the
+// blobs, thumbnails and quarantined copies of those files are queued for
+// removal in the same transaction. Locking the user row first keeps files
+// from being committed for the user in between.
 func (r *postgresUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return err
+	}
+	query := `INSERT INTO blob_deletions (storage_key, file_id, reason)
+              SELECT url, id, $2 FROM files WHERE user_id = $1
+              UNION ALL
+              SELECT quarantine_key, id, $2 FROM files WHERE user_id = $1 AND quarantine_key IS NOT NULL
+              UNION ALL
+              SELECT t.storage_key, t.file_id, $2 FROM thumbnails t JOIN files f ON f.id = t.file_id WHERE f.user_id = $1`
+	if _, err := tx.ExecContext(ctx, query, id, domain.BlobDeletionFile); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 func (r *postgresUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
-	query := `SELECT id, email, password, created_at, updated_at FROM users WHERE id = $1`
-	var user domain.User
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return getUser(r.db.QueryRowContext(ctx, query, id))
+}
+func (r *postgresUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	return getUser(r.db.QueryRowContext(ctx, query, email))
+}
+func (r *postgresUserRepository) Update(ctx context.Context, user *domain.User) error {
+	query := `UPDATE users SET email = $1, password = $2, email_verified = $3, role = $4, disabled = $5, storage_quota = $6, totp_secret = $7, totp_enabled = $8, updated_at = $9 WHERE id = $10`
+	_, err := r.db.ExecContext(ctx, query,
+		user.Email, user.Password, user.EmailVerified, user.Role, user.Disabled, user.StorageQuota,
+		sql.NullString{String: user.TOTPSecret, Valid: user.TOTPSecret != ""}, user.TOTPEnabled, user.UpdatedAt, user.ID,
+	)
+	return err
+}
+
+// ReserveStorage adds bytes to the user's used storage if that stays within
+// their quota. The check and increment are a single statement, so concurrent
+// uploads cannot overshoot the quota together.
+func (r *postgresUserRepository) ReserveStorage(ctx context.Context, id uuid.UUID, bytes, defaultQuota int64) (bool, error) {
+	query := `UPDATE users SET storage_used = storage_used + $2
+              WHERE id = $1 AND storage_used + $2 <= COALESCE(storage_quota, $3)`
+	result, err := r.db.ExecContext(ctx, query, id, bytes, defaultQuota)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *postgresUserRepository) ReleaseStorage(ctx context.Context, id uuid.UUID, bytes int64) error {
+	query := `UPDATE users SET storage_used = GREATEST(storage_used - $2, 0) WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, bytes)
+	return err
+}
+func (r *postgresUserRepository) Search(ctx context.Context, params domain.UserSearchParams) ([]*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users`
+	var args []interface{}
+	argCount := 0
+
+	if params.Query != "" {
+		argCount++
+		query += fmt.Sprintf(" WHERE email ILIKE $%d", argCount)
+		args = append(args, "%"+params.Query+"%")
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	if params.Limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, params.Limit)
+	}
+	if params.Offset > 0 {
+		argCount++
+		query += fmt.Sprintf(" OFFSET $%d", argCount)
+		args = append(args, params.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func getUser(row *sql.Row) (*domain.User, error) {
+	user, err := scanUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("user not found")
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
-func (r *postgresUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `SELECT id, email, password, created_at, updated_at FROM users WHERE email = $1`
+
+func scanUser(row scanner) (*domain.User, error) {
 	var user domain.User
-	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	var totpSecret sql.NullString
+	var storageQuota sql.NullInt64
+	err := row.Scan(
+		&user.ID, &user.Email, &user.Password, &user.EmailVerified, &user.Role, &user.Disabled,
+		&storageQuota, &totpSecret, &user.TOTPEnabled, &user.LegalHold, &user.CreatedAt, &user.UpdatedAt,
+	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("user not found")
-		}
 		return nil, err
 	}
+	user.TOTPSecret = totpSecret.String
+	if storageQuota.Valid {
+		user.StorageQuota = &storageQuota.Int64
+	}
 	return &user, nil
 }
-func (r *postgresUserRepository) Update(ctx context.Context, user *domain.User) error {
-	query := `UPDATE users SET email = $1, password = $2, updated_at = $3 WHERE id = $4`
-	_, err := r.db.ExecContext(ctx, query, user.Email, user.Password, user.UpdatedAt, user.ID)
-	return err
+
+// GetLegalHoldIDs returns the users whose files are all under legal hold.
+func (r *postgresUserRepository) GetLegalHoldIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM users WHERE legal_hold`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
@@ -0,0 +1,53 @@
+package usertokenrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filesms/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+type postgresUserTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserTokenRepository(db *sql.DB) *postgresUserTokenRepository {
+	return &postgresUserTokenRepository{db: db}
+}
+
+func (r *postgresUserTokenRepository) Create(ctx context.Context, token *domain.UserToken) error {
+	query := `INSERT INTO user_tokens (id, user_id, purpose, email, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.UserID, token.Purpose, token.Email, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+// Consume marks an unused, unexpired token as used and returns it. A token
+// can only be consumed once, even by concurrent requests.
+func (r *postgresUserTokenRepository) Consume(ctx context.Context, purpose string, tokenHash string) (*domain.UserToken, error) {
+	query := `UPDATE user_tokens SET used_at = NOW()
+              WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > NOW()
+              RETURNING id, user_id, purpose, email, token_hash, expires_at, used_at, created_at`
+	var token domain.UserToken
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, purpose, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.Purpose, &token.Email, &token.TokenHash, &token.ExpiresAt, &usedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("token not found or expired")
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return &token, nil
+}
+
+func (r *postgresUserTokenRepository) DeleteForUser(ctx context.Context, userID uuid.UUID, purpose string) error {
+	query := `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`
+	_, err := r.db.ExecContext(ctx, query, userID, purpose)
+	return err
+}
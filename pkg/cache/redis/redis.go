@@ -8,6 +8,9 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrCacheMiss is returned by Get when the key does not exist.
+var ErrCacheMiss = redis.Nil
+
 type RedisCache struct {
 	client *redis.Client
 }
@@ -35,3 +38,92 @@ func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) erro
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
+
+// SetNX stores value only if key does not exist yet and reports whether it was set.
+func (c *RedisCache) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	json, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return c.client.SetNX(ctx, key, json, expiration).Result()
+}
+
+func (c *RedisCache) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Incr increments the counter at key and returns its new value. The expiration
+// is only applied when the counter is created.
+func (c *RedisCache) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	pipe := c.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// GetDel reads and removes key atomically, for single-use values.
+func (c *RedisCache) GetDel(ctx context.Context, key string, dest interface{}) error {
+	val, err := c.client.GetDel(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), dest)
+}
+
+// TTL returns the remaining time to live of key, or ErrCacheMiss if it does
+// not exist.
+func (c *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl == -2 {
+		return 0, ErrCacheMiss
+	}
+	return ttl, nil
+}
+
+// extendScript and releaseScript only touch the key while it still holds
+// the caller's value, so a lease cannot be renewed or dropped by someone
+// who lost it.
+var (
+	extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// ExtendIfValue resets the expiration of key if it still holds value, and
+// reports whether it did.
+func (c *RedisCache) ExtendIfValue(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	json, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	n, err := extendScript.Run(ctx, c.client, []string{key}, json, expiration.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// DeleteIfValue removes key if it still holds value, and reports whether it
+// did.
+func (c *RedisCache) DeleteIfValue(ctx context.Context, key string, value interface{}) (bool, error) {
+	json, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	n, err := releaseScript.Run(ctx, c.client, []string{key}, json).Int()
+	return n == 1, err
+}
@@ -0,0 +1,222 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes when a recurring task runs next.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time
+	// if there is none.
+	Next(t time.Time) time.Time
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+// Parse reads a standard five-field expression ("minute hour day-of-month
+// month day-of-week"), one of the @yearly, @monthly, @weekly, @daily and
+// @hourly macros, or "@every <duration>". Times are matched in the location
+// of the time passed to Next.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("interval must be at least 1s")
+		}
+		return every(interval), nil
+	}
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(fields), len(parts))
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseField turns a comma-separated list of values, ranges ("1-5") and
+// steps ("*/15", "10-40/10") into a bit set.
+func parseField(raw string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(raw, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepPart, f.name)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = f.min, f.max
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseValue(from, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(to, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s", rangePart, f.name)
+			}
+		default:
+			value, err := parseValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = value, value
+			// "5/10" means from 5 to the end in steps of 10
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseValue(raw string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(raw)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, raw)
+	}
+	return v, nil
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// Give up on expressions that never match, such as February 30th
+const searchLimit = 5
+
+// Next walks wall-clock times, so a time in the hour repeated when clocks go
+// back runs once, and a time in the hour skipped when they go forward runs
+// as soon as the clocks have changed.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	year, month, day := t.Date()
+	// Calendar days are counted in UTC, where every day has 24 hours
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	fromHour, fromMinute := t.Hour(), t.Minute()+1
+
+	for ; date.Year() <= year+searchLimit; date = date.AddDate(0, 0, 1) {
+		if s.month&(1<<uint(date.Month())) != 0 && s.dayMatches(date) {
+			for hour := fromHour; hour < 24; hour++ {
+				if s.hour&(1<<uint(hour)) == 0 {
+					continue
+				}
+				minute := 0
+				if hour == fromHour {
+					minute = fromMinute
+				}
+				for ; minute < 60; minute++ {
+					if s.minute&(1<<uint(minute)) == 0 {
+						continue
+					}
+					next := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc)
+					if next.Hour() != hour || next.Minute() != minute {
+						// Skipped by the clocks going forward; run as the gap ends
+						next = time.Date(date.Year(), date.Month(), date.Day(), hour+1, 0, 0, 0, loc)
+					}
+					if next.After(t) {
+						return next
+					}
+				}
+			}
+		}
+		fromHour, fromMinute = 0, 0
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, a day
+// matching either of them is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
@@ -0,0 +1,109 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from string
+		want string // empty for no next run
+	}{
+		{"every minute", "* * * * *", time.UTC, "2024-01-01 10:00:30", "2024-01-01 10:01:00"},
+		{"end of hour", "* * * * *", time.UTC, "2024-01-01 10:59:00", "2024-01-01 11:00:00"},
+		{"fixed time later today", "30 3 * * *", time.UTC, "2024-01-01 01:00:00", "2024-01-01 03:30:00"},
+		{"fixed time tomorrow", "30 3 * * *", time.UTC, "2024-01-01 03:30:00", "2024-01-02 03:30:00"},
+		{"step", "*/15 * * * *", time.UTC, "2024-01-01 10:16:00", "2024-01-01 10:30:00"},
+		{"range with step", "10-40/10 * * * *", time.UTC, "2024-01-01 10:40:00", "2024-01-01 11:10:00"},
+		{"value with step", "5/20 * * * *", time.UTC, "2024-01-01 10:26:00", "2024-01-01 10:45:00"},
+		{"list", "0 8,20 * * *", time.UTC, "2024-01-01 09:00:00", "2024-01-01 20:00:00"},
+		{"month names", "0 0 1 jan,jul *", time.UTC, "2024-02-01 00:00:00", "2024-07-01 00:00:00"},
+		{"weekday names", "0 9 * * mon-fri", time.UTC, "2024-01-05 10:00:00", "2024-01-08 09:00:00"},
+		{"sunday as 7", "0 0 * * 7", time.UTC, "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"sunday as 0", "0 0 * * 0", time.UTC, "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"day of month or week", "0 0 15 * fri", time.UTC, "2024-01-06 00:00:00", "2024-01-12 00:00:00"},
+		{"leap day", "0 0 29 2 *", time.UTC, "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"february 30th", "0 0 30 2 *", time.UTC, "2024-01-01 00:00:00", ""},
+		{"@hourly", "@hourly", time.UTC, "2024-01-01 10:00:00", "2024-01-01 11:00:00"},
+		{"@daily", "@daily", time.UTC, "2024-01-01 10:00:00", "2024-01-02 00:00:00"},
+		{"@weekly", "@weekly", time.UTC, "2024-01-01 10:00:00", "2024-01-07 00:00:00"},
+		{"@monthly", "@monthly", time.UTC, "2024-01-15 10:00:00", "2024-02-01 00:00:00"},
+		{"@yearly", "@yearly", time.UTC, "2024-01-15 10:00:00", "2025-01-01 00:00:00"},
+		{"@every", "@every 90m", time.UTC, "2024-01-01 10:00:00", "2024-01-01 11:30:00"},
+		{"time zone", "0 9 * * *", newYork, "2024-01-01 10:00:00", "2024-01-02 09:00:00"},
+
+		// Clocks go forward from 02:00 to 03:00 on 2024-03-10 in New York
+		{"skipped hour runs after the gap", "30 2 * * *", newYork, "2024-03-10 00:00:00", "2024-03-10 03:00:00 EDT"},
+		{"after skipped hour", "30 2 * * *", newYork, "2024-03-10 03:30:00", "2024-03-11 02:30:00 EDT"},
+		{"hourly over the gap", "0 * * * *", newYork, "2024-03-10 01:30:00", "2024-03-10 03:00:00 EDT"},
+		// Clocks go back from 02:00 to 01:00 on 2024-11-03 in New York
+		{"repeated hour runs once", "30 1 * * *", newYork, "2024-11-03 00:00:00", "2024-11-03 01:30:00 EDT"},
+		{"repeated hour not run again", "30 1 * * *", newYork, "2024-11-03 01:30:00 EDT", "2024-11-04 01:30:00 EST"},
+		{"hourly over the overlap", "0 * * * *", newYork, "2024-11-03 01:00:00 EDT", "2024-11-03 02:00:00 EST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := schedule.Next(parseTime(t, tt.from, tt.loc))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Fatalf("Next = %s, want none", got)
+				}
+				return
+			}
+			if want := parseTime(t, tt.want, tt.loc); !got.Equal(want) {
+				t.Fatalf("Next = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// parseTime reads "2006-01-02 15:04:05" in loc, with an optional zone
+// abbreviation to pick one side of a repeated hour.
+func parseTime(t *testing.T, value string, loc *time.Location) time.Time {
+	t.Helper()
+	layout := "2006-01-02 15:04:05"
+	if len(value) > len(layout) {
+		layout += " MST"
+	}
+	parsed, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		t.Fatalf("invalid time %q: %v", value, err)
+	}
+	return parsed
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every",
+		"@every 500ms",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
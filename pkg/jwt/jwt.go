@@ -9,7 +9,7 @@ import (
 )
 
 type Maker interface {
-	CreateToken(userID uuid.UUID, duration time.Duration) (string, error)
+	CreateToken(userID, sessionID uuid.UUID, duration time.Duration) (string, error)
 	VerifyToken(token string) (*Payload, error)
 }
 
@@ -18,7 +18,8 @@ type JWTMaker struct {
 }
 
 type Payload struct {
-	UserID uuid.UUID `json:"user_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"sid"`
 	jwt.StandardClaims
 }
 
@@ -26,11 +27,15 @@ func NewJWTMaker(secretKey string) Maker {
 	return &JWTMaker{secretKey: secretKey}
 }
 
-func (maker *JWTMaker) CreateToken(userID uuid.UUID, duration time.Duration) (string, error) {
+func (maker *JWTMaker) CreateToken(userID, sessionID uuid.UUID, duration time.Duration) (string, error) {
+	now := time.Now()
 	payload := &Payload{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(duration).Unix(),
+			Id:        uuid.New().String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(duration).Unix(),
 		},
 	}
 
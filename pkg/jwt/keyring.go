@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// KeySet is implemented by makers that can publish their verification keys
+type KeySet interface {
+	JWKS() JWKSet
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type signingKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+}
+
+// KeyringMaker signs with the active key and verifies with any key in the
+// ring, so retiring keys stay valid until the tokens they signed expire.
+type KeyringMaker struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	issuer string
+}
+
+// NewKeyringMaker loads every <kid>.pem private key (PKCS#8 Ed25519 or RSA,
+// or PKCS#1 RSA) in dir and signs new tokens with activeKID.
+func NewKeyringMaker(dir, activeKID, issuer string) (*KeyringMaker, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	maker := &KeyringMaker{keys: make(map[string]*signingKey), issuer: issuer}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := loadSigningKey(kid, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing key %s: %w", kid, err)
+		}
+		maker.keys[kid] = key
+	}
+
+	active, ok := maker.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found in %s", activeKID, dir)
+	}
+	maker.active = active
+	return maker, nil
+}
+
+func (maker *KeyringMaker) CreateToken(userID, sessionID uuid.UUID, duration time.Duration) (string, error) {
+	now := time.Now()
+	payload := &Payload{
+		UserID:    userID,
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
+			Issuer:    maker.issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(duration).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(maker.active.method, payload)
+	token.Header["kid"] = maker.active.kid
+	return token.SignedString(maker.active.privateKey)
+}
+
+func (maker *KeyringMaker) VerifyToken(token string) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := maker.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		// The algorithm is fixed by the key, never taken from the token
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("invalid token")
+		}
+		return key.privateKey.Public(), nil
+	}
+
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, ok := jwtToken.Claims.(*Payload)
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	if maker.issuer != "" && !payload.VerifyIssuer(maker.issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	return payload, nil
+}
+
+// JWKS returns the public keys of the ring, sorted by kid.
+func (maker *KeyringMaker) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range maker.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.privateKey.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func loadSigningKey(kid, path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: SigningMethodEd25519, privateKey: key}, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, privateKey: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
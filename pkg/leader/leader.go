@@ -0,0 +1,99 @@
+package leader
+
+import (
+	"context"
+	"filesms/pkg/cache/redis"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Elector elects one leader among the instances campaigning for the same
+// name. The leader holds a lease in Redis that it renews every third of its
+// TTL; if it stops renewing, another instance takes over once it expires.
+type Elector struct {
+	cache *redis.RedisCache
+	key   string
+	id    string
+	ttl   time.Duration
+}
+
+func NewElector(cache *redis.RedisCache, name string, ttl time.Duration) *Elector {
+	hostname, _ := os.Hostname()
+	return &Elector{
+		cache: cache,
+		key:   "leader:" + name,
+		id:    hostname + "/" + uuid.NewString(),
+		ttl:   ttl,
+	}
+}
+
+// Run campaigns until ctx is cancelled. Whenever this instance becomes the
+// leader it calls lead with a context that is cancelled when leadership is
+// lost or ctx ends; lead must return promptly after that. The lease is
+// released on the way out so another instance can take over at once.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	var stop context.CancelFunc
+	var done chan struct{}
+	var renewedAt time.Time
+	stepDown := func() {
+		stop()
+		<-done
+		stop, done = nil, nil
+	}
+
+	for {
+		now := time.Now()
+		if stop == nil {
+			acquired, err := e.cache.SetNX(ctx, e.key, e.id, e.ttl)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error campaigning for %s: %v", e.key, err)
+			}
+			if acquired {
+				log.Printf("Instance %s became leader for %s", e.id, e.key)
+				renewedAt = now
+				var leaderCtx context.Context
+				leaderCtx, stop = context.WithCancel(ctx)
+				done = make(chan struct{})
+				go func() {
+					defer close(done)
+					lead(leaderCtx)
+				}()
+			}
+		} else {
+			renewed, err := e.cache.ExtendIfValue(ctx, e.key, e.id, e.ttl)
+			switch {
+			case renewed:
+				renewedAt = now
+			case err == nil:
+				log.Printf("Instance %s lost the lease for %s", e.id, e.key)
+				stepDown()
+			case now.Sub(renewedAt) >= e.ttl-e.ttl/3:
+				// The lease may expire before the next renewal, stop before
+				// another instance can take over
+				log.Printf("Instance %s could not renew the lease for %s: %v", e.id, e.key, err)
+				stepDown()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stepDown()
+				// ctx is done, release with a fresh one
+				releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				if _, err := e.cache.DeleteIfValue(releaseCtx, e.key, e.id); err != nil {
+					log.Printf("Error releasing the lease for %s: %v", e.key, err)
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,23 +2,70 @@ package middleware
 
 import (
 	"context"
+	"filesms/pkg/jwt"
+	"filesms/pkg/netutil"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 )
 
 // ContextKey is a custom type to avoid context key collisions
 type ContextKey string
 
-const UserIDKey ContextKey = "userID"
+const (
+	UserIDKey         ContextKey = "userID"
+	TokenIDKey        ContextKey = "tokenID"
+	TokenExpiresAtKey ContextKey = "tokenExpiresAt"
+	SessionIDKey      ContextKey = "sessionID"
+)
+
+// TokenRevocationChecker reports whether an otherwise valid token was revoked
+type TokenRevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, tokenID string, userID, sessionID uuid.UUID, issuedAt time.Time) (bool, error)
+}
+
+// SessionTracker records activity on the session a token belongs to
+type SessionTracker interface {
+	TouchSession(ctx context.Context, sessionID uuid.UUID, ipAddress string)
+}
+
+// APITokenVerifier resolves an API token to its owner and granted scopes
+type APITokenVerifier interface {
+	VerifyAPIToken(ctx context.Context, token string) (uuid.UUID, []string, error)
+}
+
+// AdminChecker reports whether a user may use the administration API
+type AdminChecker interface {
+	IsAdmin(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+type Authenticator struct {
+	tokenMaker  jwt.Maker
+	revocations TokenRevocationChecker
+	apiTokens   APITokenVerifier
+	admins      AdminChecker
+	sessions    SessionTracker
+}
+
+func NewAuthenticator(tokenMaker jwt.Maker, revocations TokenRevocationChecker, apiTokens APITokenVerifier, admins AdminChecker, sessions SessionTracker) *Authenticator {
+	return &Authenticator{
+		tokenMaker:  tokenMaker,
+		revocations: revocations,
+		apiTokens:   apiTokens,
+		admins:      admins,
+		sessions:    sessions,
+	}
+}
 
-// AuthMiddleware checks for a valid JWT token in the Authorization header
-func AuthMiddleware(next http.Handler) http.HandlerFunc {
+// AuthMiddleware checks for a valid, unrevoked JWT or API token in the
+// Authorization header. API tokens are only accepted on routes that declare
+// scopes, and must carry all of them; JWT sessions are not scope-limited.
+func (a *Authenticator) AuthMiddleware(next http.Handler, scopes ...string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -33,37 +80,92 @@ func AuthMiddleware(next http.Handler) http.HandlerFunc {
 		}
 
 		tokenStr := parts[1]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			log.Printf("Error parsing token: %v", err)
+		// JWTs have three dot-separated segments, anything else is an API token
+		if strings.Count(tokenStr, ".") != 2 {
+			a.authenticateAPIToken(w, r, next, tokenStr, scopes)
+			return
+		}
+		a.authenticateJWT(w, r, next, tokenStr)
+	})
+}
+
+// AdminMiddleware only lets through signed-in sessions of admin users. The
+// role is checked on every request so demotions take effect immediately.
+func (a *Authenticator) AdminMiddleware(next http.Handler) http.HandlerFunc {
+	return a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(UserIDKey).(uuid.UUID)
+		isAdmin, err := a.admins.IsAdmin(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error checking admin role: %v", err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !isAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+func (a *Authenticator) authenticateJWT(w http.ResponseWriter, r *http.Request, next http.Handler, tokenStr string) {
+	payload, err := a.tokenMaker.VerifyToken(tokenStr)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Printf("Error parsing token: %v", err)
+		return
+	}
+
+	if payload.UserID == uuid.Nil {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return
+	}
+
+	// Tokens without an ID, session or issue time cannot be revoked, so they are not accepted
+	if payload.Id == "" || payload.SessionID == uuid.Nil || payload.IssuedAt == 0 || payload.ExpiresAt == 0 {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return
+	}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userIDStr, ok := claims["user_id"].(string)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-				return
-			}
-
-			userID, err := uuid.Parse(userIDStr)
-			if err != nil {
-				http.Error(w, "Invalid user ID format", http.StatusUnauthorized)
-				return
-			}
-
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		} else {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			log.Printf("Error parsing token: %v", err)
+	revoked, err := a.revocations.IsTokenRevoked(r.Context(), payload.Id, payload.UserID, payload.SessionID, time.Unix(payload.IssuedAt, 0))
+	if err != nil {
+		log.Printf("Error checking token revocation: %v", err)
+		http.Error(w, "Unable to verify token", http.StatusServiceUnavailable)
+		return
+	}
+	if revoked {
+		http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+		return
+	}
+	a.sessions.TouchSession(r.Context(), payload.SessionID, netutil.ClientIP(r))
+
+	ctx := context.WithValue(r.Context(), UserIDKey, payload.UserID)
+	ctx = context.WithValue(ctx, TokenIDKey, payload.Id)
+	ctx = context.WithValue(ctx, TokenExpiresAtKey, time.Unix(payload.ExpiresAt, 0))
+	ctx = context.WithValue(ctx, SessionIDKey, payload.SessionID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (a *Authenticator) authenticateAPIToken(w http.ResponseWriter, r *http.Request, next http.Handler, tokenStr string, required []string) {
+	if len(required) == 0 {
+		http.Error(w, "API tokens are not accepted for this endpoint", http.StatusForbidden)
+		return
+	}
+
+	userID, granted, err := a.apiTokens.VerifyAPIToken(r.Context(), tokenStr)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Printf("Error verifying api token: %v", err)
+		return
+	}
+
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			http.Error(w, fmt.Sprintf("Token is missing required scope %q", scope), http.StatusForbidden)
+			return
 		}
-	})
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, userID)
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
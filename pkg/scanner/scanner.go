@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const chunkSize = 64 << 10
+
+// ClamdScanner scans content with a clamd daemon over its INSTREAM command.
+type ClamdScanner struct {
+	network string
+	addr    string
+	timeout time.Duration
+}
+
+// NewClamdScanner connects to clamd at addr, "host:port" for TCP or
+// "unix:/path/to/clamd.sock" for a Unix socket. timeout bounds a whole scan.
+func NewClamdScanner(addr string, timeout time.Duration) *ClamdScanner {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+	}
+	return &ClamdScanner{network: network, addr: addr, timeout: timeout}
+}
+
+// Scan streams content to clamd and returns the name of the signature it
+// matched, or "" if the content is clean.
+func (s *ClamdScanner) Scan(ctx context.Context, content io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// The z prefix makes clamd expect and send null-terminated lines
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return "", fmt.Errorf("failed to start scan: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	if err := writeChunks(conn, content); err != nil {
+		// clamd stops reading a stream over its StreamMaxLength and says so
+		if reply, _ := reader.ReadString(0); reply != "" {
+			if _, perr := parseReply(strings.TrimRight(reply, "\x00\n")); perr != nil {
+				return "", perr
+			}
+		}
+		return "", err
+	}
+
+	reply, err := reader.ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("failed to read scan result: %w", err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// writeChunks sends content as length-prefixed chunks followed by an empty
+// chunk.
+func writeChunks(conn net.Conn, content io.Reader) error {
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("failed to send content: %w", werr)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+	if _, err := conn.Write(make([]byte, 4)); err != nil {
+		return fmt.Errorf("failed to finish stream: %w", err)
+	}
+	return nil
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or
+// "<message> ERROR".
+func parseReply(reply string) (string, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	case strings.HasSuffix(result, " ERROR"):
+		return "", fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+	}
+	return "", fmt.Errorf("unexpected clamd reply %q", reply)
+}
+
+// Ping checks that clamd is reachable and answering.
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, "zPING\x00"); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		return fmt.Errorf("failed to read ping reply: %w", err)
+	}
+	if !bytes.Equal(bytes.TrimRight(reply, "\x00\n"), []byte("PONG")) {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// NoopScanner reports all content as clean, for deployments without a
+// virus scanner.
+type NoopScanner struct{}
+
+func NewNoopScanner() *NoopScanner {
+	return &NoopScanner{}
+}
+
+func (s *NoopScanner) Scan(ctx context.Context, content io.Reader) (string, error) {
+	return "", nil
+}
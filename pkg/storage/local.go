@@ -1,12 +1,37 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+const (
+	tempPrefix    = ".upload-"
+	quarantineDir = ".quarantine"
+)
+
+var (
+	// ErrInvalidKey is returned for keys that would resolve outside the storage root.
+	ErrInvalidKey = errors.New("invalid storage key")
+	// ErrChecksumMismatch is returned when content does not hash to the expected digest.
+	ErrChecksumMismatch = errors.New("content does not match expected checksum")
+)
+
+// Object describes content as it was written to storage.
+type Object struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
 type LocalStorage struct {
 	basePath string
 }
@@ -15,27 +40,68 @@ func NewLocalStorage(basePath string) (*LocalStorage, error) {
 	if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
-	return &LocalStorage{basePath: basePath}, nil
+	absPath, err := filepath.Abs(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+	return &LocalStorage{basePath: absPath}, nil
 }
 
-func (s *LocalStorage) Save(filename string, content io.Reader) (string, error) {
-	path := filepath.Join(s.basePath, filename)
-	out, err := os.Create(path)
+// Save writes content under filename atomically: it is streamed to a temp
+// file, hashed, synced and only then renamed into place, so readers never see
+// partial content. A non-empty expectedSHA256 must match the content's digest.
+func (s *LocalStorage) Save(filename string, content io.Reader, expectedSHA256 string) (*Object, error) {
+	path, err := s.resolve(filename)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	out, err := os.CreateTemp(dir, tempPrefix+"*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer out.Close()
+	tmpPath := out.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			out.Close()
+			os.Remove(tmpPath)
+		}
+	}()
 
-	_, err = io.Copy(out, content)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), content)
 	if err != nil {
-		return "", fmt.Errorf("failed to write file content: %w", err)
+		return nil, fmt.Errorf("failed to write file content: %w", err)
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && digest != expectedSHA256 {
+		return nil, ErrChecksumMismatch
 	}
 
-	return path, nil
+	if err := out.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("failed to move file into place: %w", err)
+	}
+	committed = true
+	syncDir(dir)
+
+	return &Object{Path: path, Size: size, SHA256: digest}, nil
 }
 
 func (s *LocalStorage) Get(filename string) (string, error) {
-	path := filepath.Join(s.basePath, filename)
+	path, err := s.resolve(filename)
+	if err != nil {
+		return "", err
+	}
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return "", fmt.Errorf("file not found: %w", err)
 	}
@@ -43,9 +109,108 @@ func (s *LocalStorage) Get(filename string) (string, error) {
 }
 
 func (s *LocalStorage) Delete(filename string) error {
-	path := filepath.Join(s.basePath, filename)
+	path, err := s.resolve(filename)
+	if err != nil {
+		return err
+	}
 	if err := os.Remove(path); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 	return nil
 }
+
+// Checksum reads the stored content and returns its size and SHA-256.
+func (s *LocalStorage) Checksum(filename string) (*Object, error) {
+	path, err := s.resolve(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return &Object{Path: path, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Walk calls fn for every stored blob and leftover temp file, with its key.
+// Quarantined blobs are skipped.
+func (s *LocalStorage) Walk(fn func(key string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(s.basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == quarantineDir && filepath.Dir(path) == s.basePath {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.basePath, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info)
+	})
+}
+
+// IsTemp reports whether key is a temp file of an unfinished Save.
+func IsTemp(key string) bool {
+	return strings.HasPrefix(filepath.Base(key), tempPrefix)
+}
+
+// Quarantine moves a blob out of the served tree into the quarantine
+// directory, keeping it for inspection, and returns its new key.
+func (s *LocalStorage) Quarantine(filename string) (string, error) {
+	path, err := s.resolve(filename)
+	if err != nil {
+		return "", err
+	}
+	newKey := fmt.Sprintf("%s/%s.%d", quarantineDir, filepath.ToSlash(filename), time.Now().Unix())
+	newPath, err := s.resolve(newKey)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := os.Rename(path, newPath); err != nil {
+		return "", fmt.Errorf("failed to quarantine file: %w", err)
+	}
+	return newKey, nil
+}
+
+// resolve maps a storage key to a path, refusing keys that are absolute or
+// climb out of the storage root.
+func (s *LocalStorage) resolve(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	path := filepath.Join(s.basePath, key)
+	rel, err := filepath.Rel(s.basePath, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return path, nil
+}
+
+// syncDir persists a rename in dir. Not every platform supports syncing
+// directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,166 @@
+package thumbnail
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Images over this many pixels are refused rather than decoded
+const maxPixels = 50_000_000
+
+const jpegQuality = 85
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image is too large")
+	ErrInvalid     = errors.New("invalid image")
+)
+
+// Decode reads a JPEG, PNG or GIF image (the first frame of an animation)
+// and the EXIF orientation of a JPEG, 1 if there is none. The dimensions are
+// checked before the pixels are decoded.
+func Decode(r io.ReadSeeker) (image.Image, int, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, 0, ErrUnsupported
+		}
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, 0, ErrUnsupported
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, 0, ErrTooLarge
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		orientation = readOrientation(r)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return img, orientation, nil
+}
+
+// Scale shrinks img to fit within size×size, keeping its aspect ratio, and
+// applies the EXIF orientation. Images already small enough are only
+// converted. Each output pixel averages the source pixels it covers, reading
+// the source a row at a time so large images are never copied whole.
+func Scale(img image.Image, size, orientation int) *image.RGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	// Orientations 5 to 8 swap width and height
+	fw, fh := sw, sh
+	if orientation >= 5 && orientation <= 8 {
+		fw, fh = sh, sw
+	}
+	dw, dh := fw, fh
+	if fw > size || fh > size {
+		if fw >= fh {
+			dw, dh = size, max(1, fh*size/fw)
+		} else {
+			dw, dh = max(1, fw*size/fh), size
+		}
+	}
+	if fw != sw {
+		dw, dh = dh, dw
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	row := image.NewRGBA(image.Rect(0, 0, sw, 1))
+	columns := make([]int, sw)
+	for sx := range columns {
+		columns[sx] = sx * dw / sw
+	}
+	sums := make([]uint64, dw*4)
+	counts := make([]uint64, dw)
+
+	for sy := 0; sy < sh; sy++ {
+		draw.Draw(row, row.Bounds(), img, image.Pt(b.Min.X, b.Min.Y+sy), draw.Src)
+		for sx, dx := range columns {
+			p := row.Pix[sx*4 : sx*4+4]
+			s := sums[dx*4 : dx*4+4]
+			s[0] += uint64(p[0])
+			s[1] += uint64(p[1])
+			s[2] += uint64(p[2])
+			s[3] += uint64(p[3])
+			counts[dx]++
+		}
+
+		dy := sy * dh / sh
+		if sy+1 < sh && (sy+1)*dh/sh == dy {
+			continue
+		}
+		out := dst.Pix[dy*dst.Stride : dy*dst.Stride+dw*4]
+		for dx := range counts {
+			n := counts[dx]
+			for c := 0; c < 4; c++ {
+				out[dx*4+c] = uint8((sums[dx*4+c] + n/2) / n)
+				sums[dx*4+c] = 0
+			}
+			counts[dx] = 0
+		}
+	}
+	return orient(dst, orientation)
+}
+
+// Encode writes img as JPEG, or as PNG if it has transparency, and returns
+// the content type used.
+func Encode(w io.Writer, img *image.RGBA) (string, error) {
+	if img.Opaque() {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return "image/png", png.Encode(w, img)
+}
+
+// orient rotates and flips img as EXIF orientation o asks, so it displays
+// upright.
+func orient(img *image.RGBA, o int) *image.RGBA {
+	if o < 2 || o > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	ow, oh := w, h
+	if o >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var nx, ny int
+			switch o {
+			case 2: // flip horizontally
+				nx, ny = w-1-x, y
+			case 3: // rotate 180°
+				nx, ny = w-1-x, h-1-y
+			case 4: // flip vertically
+				nx, ny = x, h-1-y
+			case 5: // transpose
+				nx, ny = y, x
+			case 6: // rotate 90° clockwise
+				nx, ny = h-1-y, x
+			case 7: // transverse
+				nx, ny = h-1-y, w-1-x
+			case 8: // rotate 90° counterclockwise
+				nx, ny = y, w-1-x
+			}
+			copy(out.Pix[ny*out.Stride+nx*4:ny*out.Stride+nx*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+	}
+	return out
+}